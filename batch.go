@@ -0,0 +1,372 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// batchResult is the outcome of a line of a batch file which was run.
+type batchResult struct {
+	line     int
+	command  string
+	exitCode ExitCode
+}
+
+// newBatchCommand returns the built in batch command. Its arguments are the file to run and its own flags along with
+// the flags which are added to the commands in the file, see parseBatchArgs.
+func newBatchCommand() *Command {
+	var (
+		continueOnError bool
+		variables       []string
+	)
+
+	cmd := NewCommand("batch", "Runs the commands in a file", "", nil)
+	cmd.LongDesc = "Usage: batch <file> [<args>]\n\n" +
+		"Runs each line of the file as a command. Blank lines and lines starting with # are ignored, and lines of the " +
+		"form NAME=VALUE set variables which are used in the following lines as $NAME or ${NAME}. Variables which " +
+		"are not set are read from the environment, $$ is a literal $ and nothing is expanded inside single " +
+		"quotes.\n\n" +
+		"Any other flags given, such as those used to connect to the cluster, are added to each command which has " +
+		"them unless the line gives them itself."
+	cmd.AddFlag(BoolFlag(&continueOnError, false, "", "continue-on-error", "",
+		"Runs the remaining commands after one fails", []string{}, false))
+	cmd.AddFlag(varFlag(newStringArray(nil, &variables), "", "var", "",
+		"Sets a variable as NAME=VALUE, can be given more than once", []string{}, nil, DefaultOptionHandler, false,
+		false, false).SetRepeatPolicy(RepeatAccumulate))
+
+	cmd.builtin = func(ctx *Context, args []string) ExitCode {
+		file, globals, exitCode, ok := cmd.parseBatchArgs(ctx, args)
+		if !ok {
+			return exitCode
+		}
+
+		vars := make(map[string]string)
+		for _, variable := range variables {
+			name, ok := parseAssignment(variable)
+			if !ok {
+				return cmd.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: "--var",
+					Err: fmt.Errorf("Expected NAME=VALUE for --var: %s", variable)})
+			}
+
+			vars[name] = variable[len(name)+1:]
+		}
+
+		return cmd.runBatch(ctx, file, globals, vars, continueOnError)
+	}
+
+	return cmd
+}
+
+// parseBatchArgs sets the flags of the batch command and returns the file to run along with the other flags, which are
+// added to the commands in the file. The other flags must belong to at least one command, and take a value in all of
+// the commands they belong to or none of them. A flag which takes a value but is given last without one, such as a
+// password to prompt for, is read using its option handler once for all of the commands. False is returned along with
+// the exit code if the batch command should not be run, because the arguments are invalid or the help has been printed.
+func (c *Command) parseBatchArgs(ctx *Context, args []string) (string, []flagArg, ExitCode, bool) {
+	ctx.prevCmds = append(ctx.prevCmds, c.Name)
+	c.initialize()
+
+	var (
+		file    string
+		own     = make([]string, 0)
+		globals = make([]flagArg, 0)
+	)
+
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := args[i], "", false
+		if idx := strings.Index(args[i], "="); idx != -1 && strings.HasPrefix(args[i], "--") {
+			name, value, hasValue = args[i][:idx], args[i][idx+1:], true
+		}
+
+		if !strings.HasPrefix(name, "-") {
+			if file != "" {
+				// Unexpected argument, exit with a non-zero exit code
+				return "", nil, c.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: name,
+					Err: fmt.Errorf("Expected flag: %s", name)}), false
+			}
+
+			file = name
+			continue
+		}
+
+		// The flags of the batch command are set by the usual parser once they have all been found, values given with
+		// an = are passed separately as variables can contain one too
+		if flag, _ := c.findFlagByName(name); flag != nil {
+			switch {
+			case hasValue && !flag.isFlag:
+				own = append(own, name, value)
+			case !hasValue && !flag.isFlag && i+1 < len(args):
+				own = append(own, name, args[i+1])
+				i++
+			default:
+				own = append(own, args[i])
+			}
+
+			continue
+		}
+
+		flags := ctx.rootCommand().findFlagsInTree(name)
+		if len(flags) == 0 {
+			// Unknown flag specified, exit with a non-zero exit code
+			return "", nil, c.parseError(ctx, &UnknownFlagError{Path: ctx.path(), Flag: name}), false
+		}
+
+		for _, flag := range flags[1:] {
+			if flag.isFlag != flags[0].isFlag {
+				return "", nil, c.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: name,
+					Err: fmt.Errorf("%s is ambiguous, it takes a value in some commands but not others", name)}), false
+			}
+		}
+
+		if flags[0].isFlag {
+			if _, err := strconv.ParseBool(value); hasValue && err != nil {
+				return "", nil, c.parseError(ctx, flags[0].invalidValueError(ctx, "", value, err)), false
+			}
+
+			globals = append(globals, flagArg{name: name, value: value, hasValue: hasValue})
+			continue
+		}
+
+		switch {
+		case !hasValue && i+1 < len(args):
+			i++
+			value = args[i]
+		case !hasValue:
+			// A flag without a value, such as a password to prompt for, is read once for all of the lines
+			var err error
+			if value, _, err = ctx.optionHandler(flags[0])(name, ""); err != nil {
+				return "", nil, c.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: name,
+					Err: flags[0].redactError(err, "")}), false
+			}
+		}
+
+		globals = append(globals, flagArg{name: name, value: value, hasValue: true})
+	}
+
+	if exitCode, ok := c.setFlags(ctx, own); !ok {
+		return "", nil, exitCode, false
+	}
+
+	if c.help {
+		fmt.Fprint(ctx.out(), c.fullUsage(ctx))
+		return "", nil, ExitCodeSuccess, false
+	}
+
+	if file == "" {
+		return "", nil, c.parseError(ctx, &ConstraintError{Path: ctx.path(),
+			Err: errors.New("A batch file is required")}), false
+	}
+
+	return file, globals, ExitCodeSuccess, true
+}
+
+// runBatch runs the commands in the file and prints a summary of their exit codes. It stops at the first command which
+// fails unless continueOnError is set, the exit code is that of the first failure. A warning is printed for each of
+// the global flags which none of the commands that were run have.
+func (c *Command) runBatch(ctx *Context, file string, globals []flagArg, vars map[string]string,
+	continueOnError bool) ExitCode {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ctx.handleRunError(err)
+	}
+
+	exitCode := ExitCodeSuccess
+	results := make([]batchResult, 0)
+	used := make(map[string]bool)
+	for idx, line := range strings.Split(string(data), "\n") {
+		if ctx.context().Err() != nil {
+			break
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		result := c.runBatchLine(ctx, file, idx+1, line, vars, globals, used)
+		if result == nil {
+			continue
+		}
+
+		results = append(results, *result)
+		if result.exitCode == ExitCodeSuccess {
+			continue
+		}
+
+		if exitCode == ExitCodeSuccess {
+			exitCode = result.exitCode
+		}
+
+		if !continueOnError {
+			break
+		}
+	}
+
+	for _, global := range globals {
+		if !used[global.name] {
+			ctx.printWarning("Warning: %s was not used as none of the commands run have it\n", global.name)
+		}
+	}
+
+	printBatchSummary(ctx, results)
+	return exitCode
+}
+
+// runBatchLine runs a line of a batch file, nil is returned if the line sets a variable rather than running a command.
+// Problems with the line itself, such as using a variable which is not set, are reported as data errors. The names of
+// the global flags which the command has are added to used.
+func (c *Command) runBatchLine(ctx *Context, file string, number int, line string, vars map[string]string,
+	globals []flagArg, used map[string]bool) *batchResult {
+	result := &batchResult{line: number, command: line, exitCode: ExitCodeDataError}
+
+	args, err := splitCommandLineExpand(line, func(s string) (string, int, error) { return expandVariable(s, vars) })
+	if err != nil {
+		ctx.printError("Error: %s:%d: %s\n", file, number, err.Error())
+		return result
+	}
+
+	if len(args) == 1 {
+		if name, ok := parseAssignment(args[0]); ok {
+			vars[name] = args[0][len(name)+1:]
+			return nil
+		}
+	}
+
+	result.command = joinCommandLine(ctx.rootCommand().RedactArgs(args))
+	if args[0] == c.Name {
+		ctx.printError("Error: %s:%d: batch files cannot run the batch command\n", file, number)
+		return result
+	}
+
+	cmd := ctx.rootCommand().findCommand(args)
+	for _, global := range globals {
+		if flag, _ := cmd.findFlagByName(global.name); flag != nil {
+			used[global.name] = true
+		}
+	}
+
+	lineCtx := ctx.lineContext()
+	result.exitCode = lineCtx.root.parseRoot(lineCtx, lineCtx.root.withFlags(args, globals))
+	return result
+}
+
+// printBatchSummary prints the exit code of each command which was run from a batch file.
+func printBatchSummary(ctx *Context, results []batchResult) {
+	lineWidth, codeWidth := len("Line"), len("Exit Code")
+	succeeded := 0
+	for _, result := range results {
+		if width := len(strconv.Itoa(result.line)); width > lineWidth {
+			lineWidth = width
+		}
+
+		if result.exitCode == ExitCodeSuccess {
+			succeeded++
+		}
+	}
+
+	s := "\n" + ctx.style.heading("Summary:") + "\n\n"
+	s += fmt.Sprintf("  %-*s   %-*s   %s\n", lineWidth, "Line", codeWidth, "Exit Code", "Command")
+	for _, result := range results {
+		s += fmt.Sprintf("  %-*d   %-*d   %s\n", lineWidth, result.line, codeWidth, result.exitCode, result.command)
+	}
+
+	s += fmt.Sprintf("\n%d of %d commands succeeded\n", succeeded, len(results))
+	fmt.Fprint(ctx.out(), s)
+}
+
+// parseAssignment returns the name of the variable set by an argument of the form NAME=VALUE, the name must start with
+// a letter or underscore followed by letters, digits and underscores.
+func parseAssignment(arg string) (string, bool) {
+	idx := strings.Index(arg, "=")
+	if idx <= 0 || variableNameLen(arg) != idx {
+		return "", false
+	}
+
+	return arg[:idx], true
+}
+
+// variableNameLen returns the length of the variable name at the start of s, zero if it doesn't start with one.
+func variableNameLen(s string) int {
+	for idx, r := range s {
+		isLetter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (idx == 0 || r < '0' || r > '9') {
+			return idx
+		}
+	}
+
+	return len(s)
+}
+
+// expandVariable returns the value of the variable referenced at the start of s, which starts with a $, along with the
+// number of bytes the reference takes up. The reference is $NAME or ${NAME} and the variable is looked up in the given
+// variables and then the environment. $$ is replaced with $ and a $ which isn't followed by a name is left as it is.
+// Errors don't include any of s as it may be part of a secret, such as a password which contains a $.
+func expandVariable(s string, vars map[string]string) (string, int, error) {
+	var (
+		rest = s[1:]
+		name string
+		size int
+	)
+
+	switch {
+	case rest == "":
+		return "$", 1, nil
+	case rest[0] == '$':
+		return "$", 2, nil
+	case rest[0] == '{':
+		end := strings.Index(rest, "}")
+		if end == -1 {
+			return "", 0, errors.New("unterminated variable")
+		}
+
+		name, size = rest[1:end], end+2
+		if variableNameLen(name) != len(name) || name == "" {
+			return "", 0, errors.New("invalid variable name")
+		}
+	default:
+		name = rest[:variableNameLen(rest)]
+		size = len(name) + 1
+		if name == "" {
+			return "$", 1, nil
+		}
+	}
+
+	value, ok := vars[name]
+	if !ok {
+		value, ok = os.LookupEnv(name)
+	}
+
+	if !ok {
+		return "", 0, errors.New("variable is not set")
+	}
+
+	return value, size, nil
+}
+
+// findFlagsInTree returns the flags with the given name from this command and all of its subcommands.
+func (c *Command) findFlagsInTree(name string) []*Flag {
+	flags := make([]*Flag, 0)
+	if flag, _ := c.findFlagByName(name); flag != nil {
+		flags = append(flags, flag)
+	}
+
+	for _, cmd := range c.Commands {
+		flags = append(flags, cmd.findFlagsInTree(name)...)
+	}
+
+	return flags
+}
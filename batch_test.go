@@ -0,0 +1,308 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeBatchFile writes the lines to a batch file in a temporary directory, returning its path.
+func writeBatchFile(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "setup.cb")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600))
+	return path
+}
+
+func TestBatch(t *testing.T) {
+	cli, ran := shellTestCLI(t)
+	cli.BatchCommand = true
+	output := captureWriter(t, cli)
+
+	file := writeBatchFile(t,
+		"# Set up the buckets",
+		`BUCKET="my bucket"`,
+		"",
+		"bucket-list",
+		`  bucket-create --name "$BUCKET" --type ${TYPE}`,
+		"bucket-create --name b2 -c other -p 'pa$word'",
+		"bucket-create --name b3 --password=$$$$",
+	)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "batch", file, "-c",
+		"localhost", "--password=secret", "--no-ssl-verify", "--var", "TYPE=ephemeral"}))
+	require.Equal(t, []string{
+		"cb bucket-list localhost secret  couchbase true",
+		"cb bucket-create localhost secret my bucket ephemeral true",
+		"cb bucket-create other pa$word b2 couchbase true",
+		"cb bucket-create localhost $$ b3 couchbase true",
+	}, *ran)
+	require.Equal(t, "\nSummary:\n\n"+
+		"  Line   Exit Code   Command\n"+
+		"  4      0           bucket-list\n"+
+		"  5      0           bucket-create --name 'my bucket' --type ephemeral\n"+
+		"  6      0           bucket-create --name b2 -c other -p *****\n"+
+		"  7      0           bucket-create --name b3 --password=*****\n\n"+
+		"4 of 4 commands succeeded\n", output())
+}
+
+func TestBatchFailures(t *testing.T) {
+	file := writeBatchFile(t,
+		"bucket-list",
+		"bucket-delete",
+		"bucket-create --name $MISSING_BATCH_VARIABLE",
+		"batch other.cb",
+		"bucket-create",
+		"bucket-create --name b1",
+	)
+
+	t.Run("StopOnError", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		output := captureWriter(t, cli)
+
+		require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "batch", file,
+			"-c", "localhost", "-p", "secret"}))
+		require.Equal(t, []string{"cb bucket-list localhost secret  couchbase false"}, *ran)
+		require.Contains(t, output(), "Invalid subcommand `bucket-delete`")
+		require.True(t, strings.HasSuffix(output(), "\nSummary:\n\n"+
+			"  Line   Exit Code   Command\n"+
+			"  1      0           bucket-list\n"+
+			"  2      64          bucket-delete\n\n"+
+			"1 of 2 commands succeeded\n"))
+	})
+
+	t.Run("ContinueOnError", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		output := captureWriter(t, cli)
+
+		require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "batch",
+			"--continue-on-error", file, "-c", "localhost", "-p", "secret"}))
+		require.Equal(t, []string{
+			"cb bucket-list localhost secret  couchbase false",
+			"cb bucket-create localhost secret b1 couchbase false",
+		}, *ran)
+		require.Contains(t, output(), ":3: column 22: variable is not set\n")
+		require.Contains(t, output(), ":4: batch files cannot run the batch command\n")
+		require.Contains(t, output(), "Flag required, but not specified: --name")
+		require.True(t, strings.HasSuffix(output(), "\nSummary:\n\n"+
+			"  Line   Exit Code   Command\n"+
+			"  1      0           bucket-list\n"+
+			"  2      64          bucket-delete\n"+
+			"  3      65          bucket-create --name $MISSING_BATCH_VARIABLE\n"+
+			"  4      65          batch other.cb\n"+
+			"  5      64          bucket-create\n"+
+			"  6      0           bucket-create --name b1\n\n"+
+			"2 of 6 commands succeeded\n"))
+	})
+}
+
+func TestBatchArgs(t *testing.T) {
+	file := writeBatchFile(t, "bucket-list")
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode ExitCode
+		expected string
+	}{
+		{name: "Help", args: []string{"--help"}, expected: "cb batch [<args>]"},
+		{name: "NoFile", args: []string{"-c", "localhost"}, exitCode: ExitCodeCLIUsageError,
+			expected: "A batch file is required"},
+		{name: "TwoFiles", args: []string{file, "other.cb"}, exitCode: ExitCodeCLIUsageError,
+			expected: "Expected flag: other.cb"},
+		{name: "UnknownFlag", args: []string{file, "--bucket", "default"}, exitCode: ExitCodeCLIUsageError,
+			expected: "Unknown flag: --bucket"},
+		{name: "MissingValue", args: []string{file, "-c"}, exitCode: ExitCodeCLIUsageError,
+			expected: "Expected argument for option: -c"},
+		{name: "InvalidVariable", args: []string{file, "--var=1A=B"}, exitCode: ExitCodeCLIUsageError,
+			expected: "Expected NAME=VALUE for --var: 1A=B"},
+		{name: "MissingFile", args: []string{filepath.Join(t.TempDir(), "missing.cb")}, exitCode: ExitCodeNoInput,
+			expected: "no such file or directory"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cli, ran := shellTestCLI(t)
+			cli.BatchCommand = true
+			output := captureWriter(t, cli)
+
+			require.Equal(t, test.exitCode, cli.Execute(context.Background(), append([]string{"cb", "batch"},
+				test.args...)))
+			require.Contains(t, output(), test.expected)
+			require.Empty(t, *ran)
+		})
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("CB_BATCH_TEST", "from-env")
+	vars := map[string]string{"BUCKET": "travel", "B": "b", "_x1": "x", "CB_BATCH_TEST": "from-file", "EMPTY": ""}
+	expand := func(s string) (string, int, error) { return expandVariable(s, vars) }
+
+	tests := []struct {
+		line     string
+		expected []string
+		err      string
+	}{
+		{line: "plain", expected: []string{"plain"}},
+		{line: "$BUCKET", expected: []string{"travel"}},
+		{line: "${BUCKET}-sample", expected: []string{"travel-sample"}},
+		{line: "$B-$_x1", expected: []string{"b-x"}},
+		{line: "$CB_BATCH_TEST", expected: []string{"from-file"}},
+		{line: `-p "pa$B" $EMPTY`, expected: []string{"-p", "pab", ""}},
+		{line: "-p 'pa$word' 'a ${' $B", expected: []string{"-p", "pa$word", "a ${", "b"}},
+		{line: `pa\$word`, expected: []string{"pa$word"}},
+		{line: "$$BUCKET", expected: []string{"$BUCKET"}},
+		{line: `"cost: $5 $"`, expected: []string{"cost: $5 $"}},
+		{line: "-p pa$word", err: "column 6: variable is not set"},
+		{line: "${}", err: "column 1: invalid variable name"},
+		{line: "-p ab${cd", err: "column 6: unterminated variable"},
+		{line: "${1A}", err: "column 1: invalid variable name"},
+	}
+
+	for _, test := range tests {
+		args, err := splitCommandLineExpand(test.line, expand)
+		if test.err != "" {
+			require.EqualError(t, err, test.err, test.line)
+			continue
+		}
+
+		require.NoError(t, err, test.line)
+		require.Equal(t, test.expected, args)
+	}
+
+	delete(vars, "CB_BATCH_TEST")
+	args, err := splitCommandLineExpand("$CB_BATCH_TEST", expand)
+	require.NoError(t, err)
+	require.Equal(t, []string{"from-env"}, args)
+}
+
+func TestBatchFlags(t *testing.T) {
+	t.Run("ContinueOnErrorFalse", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		output := captureWriter(t, cli)
+
+		file := writeBatchFile(t, "bucket-delete", "bucket-list")
+		require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "batch",
+			"--continue-on-error=false", file, "-c", "localhost", "-p", "secret"}))
+		require.Empty(t, *ran)
+		require.True(t, strings.HasSuffix(output(), "0 of 1 commands succeeded\n"))
+	})
+
+	t.Run("GlobalBoolValue", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		captureWriter(t, cli)
+
+		file := writeBatchFile(t, "bucket-list")
+		require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "batch", file, "-c",
+			"localhost", "-p", "secret", "--no-ssl-verify=false"}))
+		require.Equal(t, []string{"cb bucket-list localhost secret  couchbase false"}, *ran)
+	})
+
+	t.Run("GlobalBoolInvalidValue", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		output := captureWriter(t, cli)
+
+		file := writeBatchFile(t, "bucket-list")
+		require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "batch", file,
+			"--no-ssl-verify=maybe"}))
+		require.Empty(t, *ran)
+		require.Contains(t, output(), "maybe")
+	})
+
+	t.Run("RepeatedVariables", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		captureWriter(t, cli)
+
+		file := writeBatchFile(t, "bucket-create --name $NAME --type $TYPE")
+		require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "batch", file, "-c",
+			"localhost", "-p", "secret", "--var", "NAME=b1", "--var=TYPE=ephemeral"}))
+		require.Equal(t, []string{"cb bucket-create localhost secret b1 ephemeral false"}, *ran)
+	})
+
+	t.Run("UnusedGlobal", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		output := captureWriter(t, cli)
+
+		file := writeBatchFile(t, "bucket-list")
+		require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "batch", file, "-c",
+			"localhost", "-p", "secret", "--name", "b1"}))
+		require.Equal(t, []string{"cb bucket-list localhost secret  couchbase false"}, *ran)
+		require.Contains(t, output(), "Warning: --name was not used as none of the commands run have it\n")
+		require.NotContains(t, output(), "Warning: -c")
+	})
+
+	t.Run("AmbiguousGlobal", func(t *testing.T) {
+		cli, ran := shellTestCLI(t)
+		cli.BatchCommand = true
+		output := captureWriter(t, cli)
+
+		var force bool
+		flush := NewCommand("bucket-flush", "Flushes a bucket", "", nil)
+		flush.RunE = func(ctx context.Context, path []string) error { return nil }
+		flush.AddFlag(BoolFlag(&force, false, "", "name", "", "", []string{}, false))
+		cli.AddCommand(flush)
+
+		file := writeBatchFile(t, "bucket-list")
+		require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "batch", file,
+			"--name", "b1"}))
+		require.Empty(t, *ran)
+		require.Contains(t, output(), "--name is ambiguous")
+	})
+
+	t.Run("GlobalSecretWithoutValue", func(t *testing.T) {
+		var (
+			password string
+			ran      []string
+			prompts  int
+		)
+
+		prompt := func(opt, value string) (string, bool, error) {
+			if value == "" {
+				prompts++
+				return "prompted", false, nil
+			}
+
+			return value, true, nil
+		}
+
+		list := NewCommand("bucket-list", "", "", nil)
+		list.AddFlag(varFlag(newStringValue("", &password), "p", "password", "", "", []string{}, nil, prompt, false,
+			false, false).SetSecret(true))
+		list.RunE = func(ctx context.Context, path []string) error {
+			ran = append(ran, password)
+			return nil
+		}
+
+		cli := NewCLI("cb", "")
+		cli.BatchCommand = true
+		cli.AddCommand(list)
+		captureWriter(t, cli)
+
+		// The password is prompted for once and given to every line
+		file := writeBatchFile(t, "bucket-list", "bucket-list")
+		require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "batch", file, "-p"}))
+		require.Equal(t, []string{"prompted", "prompted"}, ran)
+		require.Equal(t, 1, prompts)
+	})
+}
@@ -11,35 +11,167 @@ licenses/APL2.txt.
 package cbflag
 
 import (
+	"context"
+	"io"
 	"os"
+	"sync"
 )
 
 type Context struct {
 	cli      *CLI
 	prevCmds []string
+	style    styler
+	errStyle styler
+	runCtx   context.Context
+
+	// cmds is the commands which have been parsed so far, in the same order as prevCmds.
+	cmds []*Command
+
+	// err is the error which caused parsing or the command to fail.
+	err error
+
+	// root is the root command being parsed, and stdout and stderr are where output is written. They are nil if the
+	// context was created directly, in which case the root command and writers of the CLI are used.
+	root   *Command
+	stdout io.Writer
+	stderr io.Writer
+
+	// check is set when the arguments are only being checked, see CheckExamples. Environment variables are ignored and
+	// nothing is prompted for or run.
+	check bool
+
+	// noPrompt is set for isolated executions, which must not read from the terminal of the process. Values which would
+	// be prompted for are reported as missing instead.
+	noPrompt bool
+}
+
+// out returns the writer help and other requested output is written to.
+func (ctx *Context) out() io.Writer {
+	if ctx.stdout == nil {
+		return ctx.cli.Writer
+	}
+
+	return ctx.stdout
+}
+
+// errOut returns the writer errors, warnings and prompts are written to.
+func (ctx *Context) errOut() io.Writer {
+	if ctx.stderr == nil {
+		return ctx.cli.errWriter()
+	}
+
+	return ctx.stderr
+}
+
+// rootCommand returns the root command being parsed.
+func (ctx *Context) rootCommand() *Command {
+	if ctx.root == nil {
+		return ctx.cli.rootCommand(nil)
+	}
+
+	return ctx.root
+}
+
+// context returns the context passed to RunE functions, this is the background context if one was not given.
+func (ctx *Context) context() context.Context {
+	if ctx.runCtx == nil {
+		return context.Background()
+	}
+
+	return ctx.runCtx
 }
 
 type CLI struct {
 	Name     string
 	Desc     string
+	LongDesc string
 	ManPath  string
 	ManPage  string
 	Run      func()
+	RunE     func(ctx context.Context, path []string) error
 	Commands []*Command
 	Flags    []*Flag
-	Writer   *os.File
+	Examples []Example
+
+	// Writer is where the help and version information are written, it is os.Stdout by default.
+	Writer io.Writer
+
+	// ErrWriter is where errors and warnings are written along with the usage shown for a usage error, it is os.Stderr
+	// by default. Prompts are written to the terminal unless ErrWriter is changed, in which case they are written to it.
+	ErrWriter io.Writer
+
+	// HelpAnnotations controls the extra information, such as default values, appended to the descriptions of
+	// flags in the help output.
+	HelpAnnotations HelpAnnotation
+
+	// UsageFormatter renders the help output, the default layout is used when it is nil.
+	UsageFormatter UsageFormatter
+
+	// HelpCommand adds a "help" subcommand which prints the usage, or manual, of the command named by its arguments.
+	HelpCommand bool
+
+	// BatchCommand adds a "batch" subcommand which runs the commands in a file, one per line.
+	BatchCommand bool
+
+	// Version, if set, adds a --version flag which prints the version information of the tool.
+	Version *VersionInfo
+
+	// VersionCommand adds a "version" subcommand which prints the version information as plain text or JSON, it
+	// requires Version to be set.
+	VersionCommand bool
+
+	// Plugins enables running external executables as subcommands. When a subcommand isn't found an executable named
+	// after the command path and subcommand joined by dashes (e.g. "couchbase-cli-bucket-stats") is searched for in
+	// PluginDirs and then PATH, it is run with the remaining arguments. See PluginEnvCLI for the environment it is
+	// given. The plugins found are listed in the help.
+	Plugins    bool
+	PluginDirs []string
+
+	// PluginSecrets passes the values of the secret flags of the root command to plugins, see PluginEnvFlagPrefix.
+	PluginSecrets bool
+
+	// Shell, if set, adds a "shell" subcommand which runs commands read from stdin, see ShellConfig.
+	Shell *ShellConfig
+
+	// Color controls whether help and errors are styled using ANSI escape sequences, by default they are when
+	// writing to a terminal.
+	Color ColorMode
+
+	// PersistentPreRun, PreRun, PostRun and PersistentPostRun are the hooks of the root command, see Command.
+	PersistentPreRun  PreRunFunc
+	PreRun            PreRunFunc
+	PostRun           PostRunFunc
+	PersistentPostRun PostRunFunc
+
+	// Middleware wraps the execution of every command, see Use.
+	Middleware []Middleware
+
+	// RepeatPolicy controls what happens when a flag is given more than once, it can be overridden for each flag. By
+	// default this is an error.
+	RepeatPolicy RepeatPolicy
+
+	// PromptMissing enables prompting for the values of any required flags which were not specified, this only
+	// happens when stdin is a terminal; otherwise missing required flags are reported as an error.
+	PromptMissing bool
+
+	// exitCodes are the exit codes registered by the tool, see RegisterExitCode.
+	exitCodes []ExitCodeInfo
+
+	// mu serializes parsing, the commands and flags hold the state of the parse in progress.
+	mu sync.RWMutex
 }
 
 func NewCLI(progName, progUsage string) *CLI {
 	return &CLI{
-		Name:     progName,
-		Desc:     progUsage,
-		ManPath:  "",
-		ManPage:  "",
-		Run:      nil,
-		Commands: make([]*Command, 0),
-		Flags:    make([]*Flag, 0),
-		Writer:   os.Stdout,
+		Name:      progName,
+		Desc:      progUsage,
+		ManPath:   "",
+		ManPage:   "",
+		Run:       nil,
+		Commands:  make([]*Command, 0),
+		Flags:     make([]*Flag, 0),
+		Writer:    os.Stdout,
+		ErrWriter: os.Stderr,
 	}
 }
 
@@ -51,36 +183,169 @@ func (c *CLI) AddFlag(flag *Flag) {
 	c.Flags = append(c.Flags, flag)
 }
 
+func (c *CLI) AddExample(commandLine, desc string) {
+	c.Examples = append(c.Examples, Example{commandLine, desc})
+}
+
+// cancelOnSignalKey is the key of the value which enables cancelling the context passed to RunE functions on SIGINT or
+// SIGTERM, see Parse.
+type cancelOnSignalKey struct{}
+
+// Parse parses the arguments, including the program name, and runs the command they specify. The process exits with
+// a non-zero exit code if parsing fails or the command returns an error. The context passed to RunE functions is
+// cancelled on SIGINT or SIGTERM while they run, at any other time, such as while parsing, prompting or running a Run
+// function, the signals have their default behavior of exiting the process.
 func (c *CLI) Parse(args []string) {
-	cmd := &Command{
-		Name:     c.Name,
-		Desc:     c.Desc,
-		Run:      c.Run,
-		ManPage:  c.ManPage,
-		Commands: c.Commands,
-		Flags:    c.Flags,
+	exitCode := c.Execute(context.WithValue(context.Background(), cancelOnSignalKey{}, true), args)
+	if exitCode != ExitCodeSuccess {
+		os.Exit(int(exitCode))
+	}
+}
+
+// Execute is the same as Parse but returns the exit code rather than exiting the process, ctx is passed to RunE
+// functions. The values of the flags are set back to how they were before the previous Execute, unless they have been
+// changed since, so values set by the caller are used as defaults. Use Flag.Set to keep a value which may be the same
+// as the one set by the previous Execute. Calls are serialized so calling Execute, ExecuteE or ExecuteIsolated on the
+// same CLI from a command, hook or middleware being run by Execute deadlocks.
+func (c *CLI) Execute(ctx context.Context, args []string) ExitCode {
+	exitCode, _ := c.execute(ctx, args)
+	return exitCode
+}
+
+// ExecuteE is the same as Execute but returns the error which caused parsing or the command to fail, the errors
+// returned when parsing fails are described in errors.go. An ExitCode is returned if there isn't a more specific error.
+// The error has already been printed.
+func (c *CLI) ExecuteE(ctx context.Context, args []string) error {
+	exitCode, err := c.execute(ctx, args)
+	if err == nil && exitCode != ExitCodeSuccess {
+		return exitCode
+	}
+
+	return err
+}
+
+func (c *CLI) execute(ctx context.Context, args []string) (ExitCode, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	context, rest := c.newContext(ctx, c.rootCommand(c.Run), args, c.Writer, c.errWriter())
+	if len(args) == 0 {
+		return context.missingProgramName(), context.err
+	}
+
+	return context.root.parseRoot(context, rest), context.err
+}
+
+// newContext returns the Context to parse the arguments, including the program name, using the given root command. The
+// arguments to parse are returned with the program name and any --no-color flag removed, the caller should report
+// missingProgramName if there aren't any.
+func (c *CLI) newContext(ctx context.Context, root *Command, args []string, stdout, stderr io.Writer) (*Context,
+	[]string) {
+	root.RunE = c.RunE
+	root.PersistentPreRun, root.PreRun = c.PersistentPreRun, c.PreRun
+	root.PostRun, root.PersistentPostRun = c.PostRun, c.PersistentPostRun
+	if len(args) > 0 {
+		args = args[1:]
 	}
 
+	color, errColor, args := c.colorEnabled(root, args, stdout, stderr)
+
 	context := &Context{
 		cli:      c,
 		prevCmds: make([]string, 0),
+		style:    styler(color),
+		errStyle: styler(errColor),
+		runCtx:   ctx,
+		root:     root,
+		stdout:   stdout,
+		stderr:   stderr,
 	}
 
-	// Parse context and arguments, exit if parsing returns a non-zero exit code
-	if exitCode := cmd.parse(context, args[1:]); exitCode != 0 {
-		os.Exit(int(exitCode))
+	return context, args
+}
+
+// errWriter returns the writer errors should be written to, this is stderr if ErrWriter has not been set.
+func (c *CLI) errWriter() io.Writer {
+	if c.ErrWriter == nil {
+		return os.Stderr
 	}
+
+	return c.ErrWriter
 }
 
 func (c *CLI) Usage() string {
-	cmd := &Command{
+	root := c.rootCommand(nil)
+	data := root.usageData(c.HelpAnnotations, false, c.Writer)
+	data.Plugins = c.usagePlugins([]string{c.Name}, root)
+	data.ExitCodes = c.usageExitCodes()
+	return renderUsage(c.UsageFormatter, data)
+}
+
+// usageExitCodes returns the exit codes to show in the help of the root command, they are only shown if the tool has
+// registered its own.
+func (c *CLI) usageExitCodes() []ExitCodeInfo {
+	if len(c.exitCodes) == 0 {
+		return nil
+	}
+
+	return c.ExitCodes()
+}
+
+// RedactArgs returns a copy of the given arguments, as would be passed to Parse, with the values of any secret flags
+// replaced by RedactedValue so that they can be safely logged.
+func (c *CLI) RedactArgs(args []string) []string {
+	if len(args) == 0 {
+		return []string{}
+	}
+
+	return append([]string{args[0]}, c.rootCommand(nil).RedactArgs(args[1:])...)
+}
+
+func (c *CLI) rootCommand(run func()) *Command {
+	return c.rootCommandWith(run, c.Commands, c.Flags)
+}
+
+// rootCommandWith returns the root command with the given subcommands and flags, along with the built in ones.
+func (c *CLI) rootCommandWith(run func(), commands []*Command, flags []*Flag) *Command {
+	// Copy the commands and flags so that adding the built in ones does not modify the CLI
+	root := &Command{
 		Name:     c.Name,
 		Desc:     c.Desc,
-		Run:      nil,
+		LongDesc: c.LongDesc,
+		Run:      run,
 		ManPage:  c.ManPage,
-		Commands: c.Commands,
-		Flags:    c.Flags,
+		Commands: append(make([]*Command, 0, len(commands)+4), commands...),
+		Flags:    append(make([]*Flag, 0, len(flags)+1), flags...),
+		Examples: c.Examples,
+	}
+
+	if c.HelpCommand {
+		root.AddCommand(newHelpCommand())
+	}
+
+	if c.BatchCommand {
+		root.AddCommand(newBatchCommand())
+	}
+
+	if c.Shell != nil {
+		root.AddCommand(newShellCommand())
+	}
+
+	// The flag is removed from the arguments before they are parsed, see colorEnabled, it is added so that it is shown
+	// in the help. Tools which define their own --no-color flag keep it.
+	if flag, _ := root.findFlagByName(NoColorFlag); flag == nil {
+		root.noColorFlag = BoolFlag(new(bool), false, "", "no-color", "", "Disables colored output", []string{}, false)
+		root.AddFlag(root.noColorFlag)
+	}
+
+	if c.Version != nil {
+		root.AddFlag(BoolFlag(&root.showVersion, false, "", "version", "", "Prints the version information",
+			[]string{}, false))
+
+		if c.VersionCommand {
+			root.AddCommand(newVersionCommand())
+		}
 	}
 
-	return cmd.Usage()
+	return root
 }
@@ -0,0 +1,144 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ColorMode controls whether the output of the CLI is styled using ANSI escape sequences.
+type ColorMode uint8
+
+const (
+	// ColorAuto styles the output when the writer is a terminal, unless disabled by NO_COLOR, CLICOLOR=0 or the
+	// --no-color flag. CLICOLOR_FORCE can be set to style output which is not going to a terminal.
+	ColorAuto ColorMode = iota
+	// ColorAlways styles the output unless disabled by NO_COLOR or the --no-color flag.
+	ColorAlways
+	// ColorNever never styles the output.
+	ColorNever
+)
+
+// NoColorFlag is the flag which disables styled output, it can be given anywhere a flag is expected on the command
+// line.
+const NoColorFlag = "--no-color"
+
+// ANSI escape sequences used to style output.
+const (
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiReset  = "\x1b[0m"
+)
+
+var (
+	// Provide variable so that tests can provide a mock implementation.
+	isTerminalWriter = func(writer io.Writer) bool {
+		file, ok := writer.(interface{ Fd() uintptr })
+		return ok && term.IsTerminal(int(file.Fd()))
+	}
+)
+
+// styler applies ANSI styles to text when enabled, otherwise the text is returned unchanged.
+type styler bool
+
+// apply wraps the text in the style, leading spaces and trailing newlines are kept outside of the style so that
+// padding is not styled and the reset is written before the cursor moves to the next line.
+func (s styler) apply(style, text string) string {
+	trimmed := strings.TrimLeft(strings.TrimRight(text, "\n"), " ")
+	if !s || trimmed == "" {
+		return text
+	}
+
+	start := strings.Index(text, trimmed)
+	return text[:start] + style + trimmed + ansiReset + text[start+len(trimmed):]
+}
+
+func (s styler) heading(text string) string { return s.apply(ansiBold, text) }
+
+func (s styler) flag(text string) string { return s.apply(ansiCyan, text) }
+
+func (s styler) error(text string) string { return s.apply(ansiRed, text) }
+
+func (s styler) warning(text string) string { return s.apply(ansiYellow, text) }
+
+// colorEnabled returns whether the output written to stdout and stderr should be styled, and the arguments with any
+// --no-color flag removed. The flag is accepted anywhere a flag of the root command, or subcommand, could be given but
+// not as the value of another flag. A --no-color flag which the tool defines itself also disables styling, but is left
+// in the arguments so that it is parsed as usual.
+func (c *CLI) colorEnabled(root *Command, args []string, stdout, stderr io.Writer) (bool, bool, []string) {
+	cmd, flags, noColor := root, false, false
+	filtered := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == NoColorFlag {
+			noColor = true
+			if flag, _ := cmd.findFlagByName(NoColorFlag); flag == nil || flag == root.noColorFlag {
+				continue
+			}
+		}
+
+		filtered = append(filtered, args[i])
+
+		if !strings.HasPrefix(args[i], "-") {
+			for _, sub := range cmd.Commands {
+				if sub.Name == args[i] && !flags {
+					cmd = sub
+					break
+				}
+			}
+
+			continue
+		}
+
+		flags = true
+		flag, _ := cmd.findFlagByName(args[i])
+		if flag == nil || flag.isFlag || strings.Contains(args[i], "=") || i+1 == len(args) {
+			continue
+		}
+
+		i++
+		filtered = append(filtered, args[i])
+	}
+
+	return c.colorEnabledFor(stdout, noColor), c.colorEnabledFor(stderr, noColor), filtered
+}
+
+// colorEnabledFor returns whether the output written to the writer should be styled.
+func (c *CLI) colorEnabledFor(writer io.Writer, noColor bool) bool {
+	switch {
+	case noColor || c.Color == ColorNever || os.Getenv("NO_COLOR") != "":
+		return false
+	case c.Color == ColorAlways:
+		return true
+	case os.Getenv("CLICOLOR_FORCE") != "" && os.Getenv("CLICOLOR_FORCE") != "0":
+		return true
+	case os.Getenv("CLICOLOR") == "0":
+		return false
+	}
+
+	return isTerminalWriter(writer)
+}
+
+// printError writes an error message to the CLI's error writer, styled as an error if enabled.
+func (ctx *Context) printError(format string, a ...interface{}) {
+	fmt.Fprint(ctx.errOut(), ctx.errStyle.error(fmt.Sprintf(format, a...)))
+}
+
+// printWarning writes a warning message to the CLI's error writer, styled as a warning if enabled.
+func (ctx *Context) printWarning(format string, a ...interface{}) {
+	fmt.Fprint(ctx.errOut(), ctx.errStyle.warning(fmt.Sprintf(format, a...)))
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mockIsTerminalWriter(t *testing.T, terminal bool) {
+	orig := isTerminalWriter
+	t.Cleanup(func() { isTerminalWriter = orig })
+	isTerminalWriter = func(io.Writer) bool { return terminal }
+}
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     ColorMode
+		terminal bool
+		env      map[string]string
+		args     []string
+		expected bool
+	}{
+		{name: "AutoTerminal", terminal: true, expected: true},
+		{name: "AutoNotTerminal"},
+		{name: "AutoNoColor", terminal: true, env: map[string]string{"NO_COLOR": "1"}},
+		{name: "AutoCLIColorOff", terminal: true, env: map[string]string{"CLICOLOR": "0"}},
+		{name: "AutoForce", env: map[string]string{"CLICOLOR_FORCE": "1"}, expected: true},
+		{name: "AutoForceZero", env: map[string]string{"CLICOLOR_FORCE": "0"}},
+		{name: "AutoFlag", terminal: true, args: []string{"bucket", "--no-color"}},
+		{name: "Always", mode: ColorAlways, expected: true},
+		{name: "AlwaysCLIColorOff", mode: ColorAlways, env: map[string]string{"CLICOLOR": "0"}, expected: true},
+		{name: "AlwaysNoColor", mode: ColorAlways, env: map[string]string{"NO_COLOR": "1"}},
+		{name: "AlwaysFlag", mode: ColorAlways, args: []string{"--no-color"}},
+		{name: "Never", mode: ColorNever, terminal: true, env: map[string]string{"CLICOLOR_FORCE": "1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockIsTerminalWriter(t, test.terminal)
+			for _, name := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE"} {
+				t.Setenv(name, test.env[name])
+			}
+
+			cli := NewCLI("cb", "")
+			cli.Color = test.mode
+
+			enabled, errEnabled, args := cli.colorEnabled(cli.rootCommand(nil), append([]string{}, test.args...),
+				cli.Writer, cli.ErrWriter)
+			require.Equal(t, test.expected, enabled)
+			require.Equal(t, test.expected, errEnabled)
+			require.NotContains(t, args, NoColorFlag)
+		})
+	}
+}
+
+func TestNoColorFlagPosition(t *testing.T) {
+	var name, password string
+
+	cli := NewCLI("cb", "")
+	create := NewCommand("bucket-create", "", "", func() {})
+	create.AddFlag(StringFlag(&name, "", "", "name", "", "", []string{}, nil, false, false))
+	create.AddFlag(PasswordFlag(&password, "", []string{}, false, false))
+	cli.AddCommand(create)
+
+	tests := []struct {
+		name     string
+		mode     ColorMode
+		args     []string
+		expected []string
+	}{
+		{name: "Root", args: []string{"--no-color", "bucket-create"}, expected: []string{"bucket-create"}},
+		{name: "Flag", args: []string{"bucket-create", "--no-color", "--name", "b1"},
+			expected: []string{"bucket-create", "--name", "b1"}},
+		{name: "Value", args: []string{"bucket-create", "--name", "--no-color"},
+			expected: []string{"bucket-create", "--name", "--no-color"}},
+		{name: "EqualsValue", args: []string{"bucket-create", "--name=b1", "--no-color"},
+			expected: []string{"bucket-create", "--name=b1"}},
+		{name: "SecretValue", args: []string{"bucket-create", "-p", "--no-color"},
+			expected: []string{"bucket-create", "-p", "--no-color"}},
+		{name: "Never", mode: ColorNever, args: []string{"bucket-create", "--no-color"},
+			expected: []string{"bucket-create"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cli.Color = test.mode
+
+			_, _, args := cli.colorEnabled(cli.rootCommand(nil), test.args, cli.Writer, cli.ErrWriter)
+			require.Equal(t, test.expected, args)
+		})
+	}
+}
+
+func TestNoColorFlagDefinedByTool(t *testing.T) {
+	var noColor bool
+
+	cli := NewCLI("cb", "")
+	cli.Color = ColorAlways
+	cli.AddFlag(BoolFlag(&noColor, false, "", "no-color", "", "Turns off colors", []string{}, false))
+	cli.RunE = func(ctx context.Context, path []string) error { return nil }
+	output := captureWriter(t, cli)
+
+	// The tool's flag is parsed rather than removed, and still disables styling
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--no-color"}))
+	require.True(t, noColor)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--no-color", "-h"}))
+	require.NotContains(t, output(), "\x1b[")
+	require.Contains(t, output(), "--no-color               Turns off colors\n")
+	require.NotContains(t, output(), "Disables colored output")
+}
+
+func TestStyler(t *testing.T) {
+	require.Equal(t, "Error\n", styler(false).error("Error\n"))
+	require.Equal(t, "\x1b[31mError\x1b[0m\n", styler(true).error("Error\n"))
+	require.Equal(t, "\x1b[33mWarning\x1b[0m", styler(true).warning("Warning"))
+	require.Equal(t, "\n", styler(true).heading("\n"))
+	require.Equal(t, "   \x1b[36m--bucket\x1b[0m", styler(true).flag("   --bucket"))
+}
+
+func TestColoredOutput(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	var (
+		name  string
+		force bool
+	)
+
+	cmd := NewCommand("bucket", "", "", func() {})
+	cmd.AddFlag(StringFlag(&name, "", "", "bucket", "", "The name of the bucket", []string{}, nil, true, false))
+	cmd.AddFlag(BoolFlag(&force, false, "", "force", "", "Force the operation", []string{}, false))
+	cmd.initialize()
+
+	cli := NewCLI("cb", "")
+	output := captureWriter(t, cli)
+
+	ctx := &Context{cli: cli, prevCmds: []string{"cb"}, style: styler(true), errStyle: styler(true)}
+	require.Equal(t, ExitCodeCLIUsageError, cmd.parse(ctx, []string{"--force"}))
+	require.Equal(t, "\x1b[31mFlag required, but not specified: --bucket\x1b[0m\n\n"+
+		"cb bucket [<args>]\n\n"+
+		"\x1b[1mRequired Flags:\x1b[0m\n\n"+
+		"     \x1b[36m--bucket\x1b[0m                 The name of the bucket\n\n"+
+		"\x1b[1mOptional Flags:\x1b[0m\n\n"+
+		"     \x1b[36m--force\x1b[0m                  Force the operation\n"+
+		"  \x1b[36m-h,--help\x1b[0m                   Prints the help message\n\n", output())
+}
@@ -11,6 +11,7 @@ licenses/APL2.txt.
 package cbflag
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -23,14 +24,42 @@ import (
 type Command struct {
 	Name        string
 	Desc        string
+	LongDesc    string
 	ManPage     string
 	Run         func()
 	Hidden      bool
 	IsManualCmd bool
 	help        bool
+	showVersion bool
 	initialized bool
 	Commands    []*Command
 	Flags       []*Flag
+	Examples    []Example
+
+	// RunE is called in place of Run if it is set, ctx is cancelled when the process is interrupted and path is the
+	// names of the commands which lead to this one. The returned error decides the exit code of the process, see
+	// ExitError.
+	RunE func(ctx context.Context, path []string) error
+
+	// PersistentPreRun and PersistentPostRun are run around this command and all of its subcommands, PreRun and
+	// PostRun only around this command. See execute for the order they are run in.
+	PersistentPreRun  PreRunFunc
+	PreRun            PreRunFunc
+	PostRun           PostRunFunc
+	PersistentPostRun PostRunFunc
+
+	// Middleware wraps the execution of this command and all of its subcommands, see Use.
+	Middleware []Middleware
+
+	// builtin handles the arguments of the commands provided by cbflag, such as help, in place of the usual parser.
+	builtin func(ctx *Context, args []string) ExitCode
+
+	// helpFlag is the flag added by initialize.
+	helpFlag *Flag
+
+	// noColorFlag is the --no-color flag added to the root command when the tool doesn't define its own, see
+	// NoColorFlag.
+	noColorFlag *Flag
 }
 
 // ExitCode defines a type of exit codes that can be used by functions that use the cbflag library. The exit codes that
@@ -40,8 +69,17 @@ type Command struct {
 type ExitCode uint8
 
 const (
-	ExitCodeSuccess       ExitCode = 0  // Successful termination
-	ExitCodeCLIUsageError ExitCode = 64 // Command line usage error
+	ExitCodeSuccess       ExitCode = 0   // Successful termination
+	ExitCodeCLIUsageError ExitCode = 64  // Command line usage error
+	ExitCodeDataError     ExitCode = 65  // Input data was incorrect in some way
+	ExitCodeNoInput       ExitCode = 66  // An input file did not exist or was not readable
+	ExitCodeUnavailable   ExitCode = 69  // A service, such as the cluster, is unavailable
+	ExitCodeSoftwareError ExitCode = 70  // Internal software error, used for errors returned from RunE without a code
+	ExitCodeIOError       ExitCode = 74  // An error occurred whilst doing I/O on a file
+	ExitCodeTempFailure   ExitCode = 75  // Temporary failure, the user is invited to retry
+	ExitCodeNoPermission  ExitCode = 77  // Insufficient permission to perform the operation
+	ExitCodeConfigError   ExitCode = 78  // Something was found in an unconfigured or misconfigured state
+	ExitCodeInterrupted   ExitCode = 130 // The command was interrupted, this is 128 plus the number of SIGINT
 )
 
 func NewCommand(name, usage, manPage string, cb func()) *Command {
@@ -67,13 +105,18 @@ func (c *Command) AddFlag(flag *Flag) {
 	c.Flags = append(c.Flags, flag)
 }
 
+func (c *Command) AddExample(commandLine, desc string) {
+	c.Examples = append(c.Examples, Example{commandLine, desc})
+}
+
 func (c *Command) initialize() {
 	if c.initialized {
 		return
 	}
 
 	c.initialized = true
-	c.AddFlag(helpFlag(&c.help))
+	c.helpFlag = helpFlag(&c.help)
+	c.AddFlag(c.helpFlag)
 
 	for curIdx, curFlag := range c.Flags {
 		for cmpIdx, cmpFlag := range c.Flags {
@@ -92,14 +135,72 @@ func (c *Command) initialize() {
 	}
 }
 
+// clone returns a copy of the command and its subcommands which has not been initialized or parsed, the values of the
+// flags are not stored in the variables the flags were created with. An error is returned if a flag can't be copied.
+func (c *Command) clone() (*Command, error) {
+	cloned := &Command{
+		Name:              c.Name,
+		Desc:              c.Desc,
+		LongDesc:          c.LongDesc,
+		ManPage:           c.ManPage,
+		Run:               c.Run,
+		Hidden:            c.Hidden,
+		IsManualCmd:       c.IsManualCmd,
+		Commands:          make([]*Command, 0, len(c.Commands)),
+		Flags:             make([]*Flag, 0, len(c.Flags)),
+		Examples:          c.Examples,
+		RunE:              c.RunE,
+		PersistentPreRun:  c.PersistentPreRun,
+		PreRun:            c.PreRun,
+		PostRun:           c.PostRun,
+		PersistentPostRun: c.PersistentPostRun,
+		Middleware:        c.Middleware,
+		builtin:           c.builtin,
+	}
+
+	for _, flag := range c.Flags {
+		if flag == c.helpFlag {
+			continue
+		}
+
+		clonedFlag, err := flag.clone()
+		if err != nil {
+			return nil, err
+		}
+
+		cloned.Flags = append(cloned.Flags, clonedFlag)
+	}
+
+	for _, cmd := range c.Commands {
+		clonedCmd, err := cmd.clone()
+		if err != nil {
+			return nil, err
+		}
+
+		cloned.Commands = append(cloned.Commands, clonedCmd)
+	}
+
+	return cloned, nil
+}
+
 func (c *Command) parse(ctx *Context, args []string) ExitCode {
 	c.initialize()
 
+	// The arguments of manual and built in commands can't be checked without running them
+	if ctx.check && (c.IsManualCmd || c.builtin != nil) {
+		return ExitCodeSuccess
+	}
+
 	if c.IsManualCmd {
 		return c.showManual(ctx)
 	}
 
+	if c.builtin != nil {
+		return c.builtin(ctx, args)
+	}
+
 	ctx.prevCmds = append(ctx.prevCmds, c.Name)
+	ctx.cmds = append(ctx.cmds, c)
 	if len(args) == 0 {
 		// Check if there are flags set via environment variables
 		return c.parseFlags(ctx, args)
@@ -114,7 +215,7 @@ func (c *Command) parse(ctx *Context, args []string) ExitCode {
 
 func (c *Command) parseCommands(ctx *Context, args []string) ExitCode {
 	if len(args) == 0 {
-		fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
+		fmt.Fprint(ctx.out(), c.fullUsage(ctx))
 		// No commands are specified, print help and exit with 0 exit code
 		return ExitCodeSuccess
 	}
@@ -125,24 +226,106 @@ func (c *Command) parseCommands(ctx *Context, args []string) ExitCode {
 		}
 	}
 
-	fmt.Fprintf(ctx.cli.Writer, "Invalid subcommand `%s`\n\n", args[0])
-	fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
+	// Look for an external plugin which implements the subcommand, see CLI.Plugins
+	if plugin := ctx.cli.findPlugin(ctx.prevCmds, args[0]); plugin != "" {
+		if ctx.check {
+			return ExitCodeSuccess
+		}
+
+		// The root command isn't otherwise parsed when running a subcommand, its flags are resolved from the
+		// environment so that the plugin is given the same values as a command would see
+		if _, exitCode, ok := ctx.rootCommand().setEnvFlags(ctx); !ok {
+			return exitCode
+		}
+
+		ctx.prevCmds = append(ctx.prevCmds, args[0])
+		return ctx.runPlugin(plugin, args[1:])
+	}
+
 	// Got an invalid subcommand, exit with a non-zero exit code
-	return ExitCodeCLIUsageError
+	return c.parseError(ctx, &UnknownCommandError{Path: ctx.path(), Name: args[0]})
 }
 
 func (c *Command) parseFlags(ctx *Context, args []string) ExitCode {
 	// Process environment variables first
+	hasEnvironmentVar, exitCode, ok := c.setEnvFlags(ctx)
+	if !ok {
+		return exitCode
+	}
+
+	// If there are no Flags or Environment variables print the help
+	if len(args) == 0 && !hasEnvironmentVar {
+		fmt.Fprint(ctx.out(), c.fullUsage(ctx))
+		// Print help and exit with 0 exit code
+		return ExitCodeSuccess
+	}
+
+	if exitCode, ok := c.setFlags(ctx, args); !ok {
+		return exitCode
+	}
+
+	// Check to see if the help flag was specified
+	if c.help && ctx.check {
+		return ExitCodeSuccess
+	}
+
+	if c.help {
+		flag, _ := c.findFlagByName("-h")
+		if flag.foundLong && c.ManPage != "" {
+			c.showManual(ctx)
+		} else {
+			fmt.Fprint(ctx.out(), c.fullUsage(ctx))
+		}
+
+		return ExitCodeSuccess
+	}
+
+	// Check to see if the version flag was specified
+	if c.showVersion {
+		fmt.Fprint(ctx.out(), ctx.cli.Version.resolve().Text(ctx.cli.Name))
+		return ExitCodeSuccess
+	}
+
+	// Any required flags which could not be read from the user are reported as missing below
+	if ctx.cli.PromptMissing && promptIsTerminal() && !ctx.check && !ctx.noPrompt {
+		c.promptMissing(ctx)
+	}
+
+	// Check that all required flags have been specified
+	missing := make([]string, 0)
+	for _, flag := range c.Flags {
+		if flag.required && !flag.found() {
+			missing = append(missing, flag.names())
+		}
+	}
+
+	if len(missing) > 0 {
+		// Not all required flags have been specified, exit with a non-zero exit code
+		return c.parseError(ctx, &MissingRequiredError{Path: ctx.path(), Flags: missing})
+	}
+
+	if ctx.check {
+		return ExitCodeSuccess
+	}
+
+	return c.run(ctx)
+}
+
+// setEnvFlags sets the flags which have a value in their environment variable, returning whether there were any. The
+// exit code is returned along with false if a value is invalid, the error has already been printed.
+func (c *Command) setEnvFlags(ctx *Context) (bool, ExitCode, bool) {
+	for _, flag := range c.Flags {
+		flag.snapshotValue()
+	}
+
 	var hasEnvironmentVar bool
-	for i := 0; i < len(c.Flags); i++ {
+	for i := 0; i < len(c.Flags) && !ctx.check; i++ {
 		value := os.Getenv(c.Flags[i].env)
 		if value != "" {
 			err := c.Flags[i].value.Set(value)
 			if err != nil {
-				fmt.Fprintf(ctx.cli.Writer, "value of '%s' is not valid\n", c.Flags[i].env)
-				fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 				// Failed to parse flag, exit with a non-zero exit code
-				return ExitCodeCLIUsageError
+				return false, c.parseError(ctx, c.Flags[i].invalidValueError(ctx, c.Flags[i].env, value, err)), false
 			}
 
 			c.Flags[i].markFound(value, true, false)
@@ -150,20 +333,28 @@ func (c *Command) parseFlags(ctx *Context, args []string) ExitCode {
 			err = c.Flags[i].validate()
 
 			if err != nil {
-				fmt.Fprintf(ctx.cli.Writer, "%s\n\n", err.Error())
-				fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 				// Failed to validate flag, exit with a non-zero exit code
-				return ExitCodeCLIUsageError
+				return false, c.parseError(ctx, c.Flags[i].validationError(ctx, value, err)), false
 			}
 		}
 	}
-	// If there are no Flags or Environment variables print the help
-	if len(args) == 0 && !hasEnvironmentVar {
-		fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
-		// Print help and exit with 0 exit code
-		return ExitCodeSuccess
-	}
 
+	return hasEnvironmentVar, ExitCodeSuccess, true
+}
+
+// run calls the function of the command along with its hooks and middleware, returning the exit code the process
+// should exit with.
+func (c *Command) run(ctx *Context) ExitCode {
+	fn := ctx.wrap(func(runCtx context.Context, inv *Invocation) error {
+		return c.execute(runCtx, inv.Path, ctx.cmds)
+	})
+
+	return ctx.handleRunError(fn(ctx.context(), c.invocation(ctx)))
+}
+
+// setFlags sets the flags given in the arguments, each argument must be a flag or the value of the flag before it. The
+// exit code is returned along with false if a flag could not be set, the error has already been printed.
+func (c *Command) setFlags(ctx *Context, args []string) (ExitCode, bool) {
 	for i := 0; i < len(args); i++ {
 		var (
 			flagName         string
@@ -185,8 +376,13 @@ func (c *Command) parseFlags(ctx *Context, args []string) ExitCode {
 
 			split := strings.Split(args[i], "=")
 			if len(split) != 2 {
-				fmt.Fprintf(ctx.cli.Writer, "'=' appears too many times in %s\n\n", args[i])
-				return ExitCodeCLIUsageError
+				arg := args[i]
+				if flag, _ := c.findFlagByName(split[0]); flag != nil && flag.secret {
+					arg = split[0] + "=" + RedactedValue
+				}
+
+				return c.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: arg,
+					Err: fmt.Errorf("'=' appears too many times in %s", arg)}), false
 			}
 
 			flagName = split[0]
@@ -200,116 +396,87 @@ func (c *Command) parseFlags(ctx *Context, args []string) ExitCode {
 			}
 
 		default:
-			fmt.Fprintf(ctx.cli.Writer, "Expected flag: %s\n\n", args[i])
-			fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 			// Flag parser expects "-" or "--" prefix for a flag, exit with a non-zero exit code
-			return ExitCodeCLIUsageError
+			return c.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: args[i],
+				Err: fmt.Errorf("Expected flag: %s", args[i])}), false
 		}
 
 		flag, isDeprecated := c.findFlagByName(flagName)
 		if flag == nil {
-			fmt.Fprintf(ctx.cli.Writer, "Unknown flag: %s\n\n", flagName)
-			fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 			// Unknown flag specified, exit with a non-zero exit code
-			return ExitCodeCLIUsageError
+			return c.parseError(ctx, &UnknownFlagError{Path: ctx.path(), Flag: flagName}), false
 		}
 
 		if isDeprecated {
-			fmt.Fprintf(ctx.cli.Writer, "Warning: %s is deprecated, use -%s/--%s\n", flagName,
+			ctx.printWarning("Warning: %s is deprecated, use -%s/--%s\n", flagName,
 				flag.short, flag.long)
 		}
 
-		if flag.foundNonEnv() {
-			extra := ""
+		switch {
+		case !flag.foundNonEnv():
+			// The command line replaces any value from the environment
+			if flag.foundEnv {
+				flag.restoreValue()
+			}
+		case flag.repeatPolicy(ctx.cli) == RepeatError:
+			err := &DuplicateFlagError{Path: ctx.path(), Flag: flag.names()}
 			if flag.deprecatedFlagSpecified() {
-				extra = fmt.Sprintf(" by a deprecated flag (%s)", flag.deprecatedFlagsString())
+				err.Deprecated = flag.deprecatedFlagsString()
 			}
 
-			fmt.Fprintf(ctx.cli.Writer, "Argument for -%s/--%s already specified%s\n\n",
-				flag.short, flag.long, extra)
-			fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 			// Argument for a flag is specified repeatedly, exit with a non-zero exit code
-			return ExitCodeCLIUsageError
+			return c.parseError(ctx, err), false
+		case flag.repeatPolicy(ctx.cli) == RepeatFirstWins:
+			if !flag.isFlag && valueFromNextArg {
+				i++
+			}
+
+			continue
+		case flag.repeatPolicy(ctx.cli) == RepeatLastWins:
+			flag.restoreValue()
 		}
 
 		flag.markFound(flagName, false, isDeprecated)
 
+		// Secret flags without a value are prompted for, which is only done when running the command
+		if !flag.isFlag && ctx.check && flag.secret && flagValue == "" {
+			continue
+		}
+
 		if !flag.isFlag {
-			value, _, err := flag.optHandler(flagName, flagValue)
+			value, _, err := ctx.optionHandler(flag)(flagName, flagValue)
 			if err != nil {
-				fmt.Fprint(ctx.cli.Writer, err.Error())
-				fmt.Fprint(ctx.cli.Writer, "\n\n"+c.usageTitle(ctx)+c.Usage())
 				// Error in optHandler, exit with a non-zero exit code
-				return ExitCodeCLIUsageError
+				return c.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: flagName,
+					Err: flag.redactError(err, flagValue)}), false
 			}
 
 			if err := flag.value.Set(value); err != nil {
-				fmt.Fprintf(ctx.cli.Writer, "Unable to process value for flag: %s. %s\n\n", flagName, err.Error())
-				fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 				// Failed to process value for flag, exit with a non-zero exit code
-				return ExitCodeCLIUsageError
+				return c.parseError(ctx, flag.invalidValueError(ctx, "", value, err)), false
 			}
 
 			if valueFromNextArg {
 				i++
 			}
+		} else if strings.HasPrefix(args[i], "--") && strings.Contains(args[i], "=") {
+			// A bool flag can be given a value, such as --force=false
+			if err := flag.value.Set(flagValue); err != nil {
+				return c.parseError(ctx, flag.invalidValueError(ctx, "", flagValue, err)), false
+			}
 		} else {
 			// We know we have a bool flag here and "true" will parse so no need to check the error
 			flag.value.Set("true") //nolint:errcheck
 		}
 
 		if err := flag.validate(); err != nil {
-			fmt.Fprintf(ctx.cli.Writer, "%s\n\n", err.Error())
-			fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
 			// Failed to validate the flag, exit with a non-zero exit code
-			return ExitCodeCLIUsageError
-		}
-
-	}
-
-	// Check to see if the help flag was specified
-	if c.help {
-		flag, _ := c.findFlagByName("-h")
-		if flag.foundLong && c.ManPage != "" {
-			c.showManual(ctx)
-		} else {
-			fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
-		}
-
-		return ExitCodeSuccess
-	}
-
-	// Check that all required flags have been specified
-	allRequired := true
-	for _, flag := range c.Flags {
-		if flag.required && !flag.found() {
-			fmt.Fprint(ctx.cli.Writer, "Flag required, but not specified: ")
-			if flag.short != "" {
-				fmt.Fprintf(ctx.cli.Writer, "-%s", flag.short)
-			}
-
-			if flag.short != "" && flag.long != "" {
-				fmt.Fprint(ctx.cli.Writer, "/")
-			}
-
-			if flag.long != "" {
-				fmt.Fprintf(ctx.cli.Writer, "--%s", flag.long)
-			}
-
-			fmt.Fprint(ctx.cli.Writer, "\n")
-			allRequired = false
+			return c.parseError(ctx, flag.validationError(ctx, flagValue, err)), false
 		}
-	}
 
-	if !allRequired {
-		fmt.Fprintf(ctx.cli.Writer, "\n")
-		fmt.Fprint(ctx.cli.Writer, c.usageTitle(ctx)+c.Usage())
-		// Not all required flags have been specified, exit with a non-zero exit code
-		return ExitCodeCLIUsageError
 	}
 
-	c.Run()
-	return ExitCodeSuccess
+	return ExitCodeSuccess, true
 }
 
 func (c *Command) findFlagByName(f string) (*Flag, bool) {
@@ -334,13 +501,53 @@ func (c *Command) findFlagByName(f string) (*Flag, bool) {
 	return nil, false
 }
 
+// RedactArgs returns a copy of the given arguments (which should not include the program name) where the values of
+// any secret flags are replaced by RedactedValue. Commands are resolved in the same way as when parsing so that only
+// the flags of the commands being run are considered.
+func (c *Command) RedactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	cmd := c
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if !strings.HasPrefix(arg, "-") {
+			for _, sub := range cmd.Commands {
+				if sub.Name == arg {
+					cmd = sub
+					break
+				}
+			}
+
+			continue
+		}
+
+		if idx := strings.Index(arg, "="); idx != -1 && strings.HasPrefix(arg, "--") {
+			if flag, _ := cmd.findFlagByName(arg[:idx]); flag != nil && flag.secret {
+				redacted[i] = arg[:idx+1] + RedactedValue
+			}
+
+			continue
+		}
+
+		flag, _ := cmd.findFlagByName(arg)
+		if flag == nil || flag.isFlag || i+1 >= len(redacted) {
+			continue
+		}
+
+		i++
+		redacted[i] = flag.redact(redacted[i])
+	}
+
+	return redacted
+}
+
 func (c *Command) showManual(ctx *Context) ExitCode {
 	mcmd := exec.Command("man", filepath.Join(ctx.cli.ManPath, c.ManPage))
 	mcmd.Stdout = os.Stdout
 
 	if err := man.ShowManual(ctx.cli.ManPath, c.ManPage); err != nil {
-		fmt.Fprint(ctx.cli.Writer, err.Error()+"\n")
-		return ExitCodeCLIUsageError
+		return ctx.reportError(&ManualError{Path: ctx.path(), ManPage: c.ManPage, Err: err})
 	}
 
 	return ExitCodeSuccess
@@ -361,48 +568,6 @@ func (c *Command) usageTitle(ctx *Context) string {
 	return s
 }
 
-func (c *Command) Usage() string {
-	s := ""
-	if c.hasCommands() {
-		maxLen := 0
-		for _, cmd := range c.Commands {
-			if len(cmd.Name) > maxLen {
-				maxLen = len(cmd.Name)
-			}
-		}
-
-		for _, cmd := range c.Commands {
-			if !cmd.Hidden {
-				spaces := strings.Repeat(" ", maxLen-len(cmd.Name))
-				s += fmt.Sprintf("  %s%s   %s\n", cmd.Name, spaces, cmd.Desc)
-			}
-		}
-		s += "\n"
-	}
-
-	if c.hasRequiredFlags() {
-		s += "Required Flags:\n\n"
-		for _, flag := range c.Flags {
-			if flag.required {
-				s += flag.usageString()
-			}
-		}
-		s += "\n"
-	}
-
-	if c.hasOptionalFlags() {
-		s += "Optional Flags:\n\n"
-		for _, flag := range c.Flags {
-			if !flag.required {
-				s += flag.usageString()
-			}
-		}
-		s += "\n"
-	}
-
-	return s
-}
-
 func (c *Command) hasCommands() bool {
 	return len(c.Commands) > 0
 }
@@ -410,23 +575,3 @@ func (c *Command) hasCommands() bool {
 func (c *Command) hasFlags() bool {
 	return len(c.Flags) > 0
 }
-
-func (c *Command) hasOptionalFlags() bool {
-	for _, flag := range c.Flags {
-		if !flag.required {
-			return true
-		}
-	}
-
-	return false
-}
-
-func (c *Command) hasRequiredFlags() bool {
-	for _, flag := range c.Flags {
-		if flag.required {
-			return true
-		}
-	}
-
-	return false
-}
@@ -11,9 +11,13 @@ licenses/APL2.txt.
 package cbflag
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/couchbase/cbflag/pwd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,7 +26,7 @@ import (
 // arguments were specified (not an explicit error case, only help is printed).
 func TestExitCodeParseCommandsNoArgs(t *testing.T) {
 	command := NewCommand("", "", "", func() {})
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseCommands(contextPtr, []string{})
 	require.Equal(t, ExitCodeSuccess, exitCode)
 }
@@ -31,7 +35,7 @@ func TestExitCodeParseCommandsNoArgs(t *testing.T) {
 // code if a wrong subcommand was specified.
 func TestExitCodeParseCommandsWrongSubcommand(t *testing.T) {
 	command := NewCommand("actualName", "", "", func() {})
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseCommands(contextPtr, []string{"wrongName"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -40,7 +44,7 @@ func TestExitCodeParseCommandsWrongSubcommand(t *testing.T) {
 // were specified (not an explicit error case, only help is printed).
 func TestExitCodeParseFlagsNoArgs(t *testing.T) {
 	command := NewCommand("", "", "", func() {})
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{})
 	require.Equal(t, ExitCodeSuccess, exitCode)
 }
@@ -53,7 +57,7 @@ func TestExitCodeParseFlagsUnparsableEnvFlag(t *testing.T) {
 	flag := IntFlag(&result, 0, "", "", "FOO", "", []string{},
 		func(Value) error { return assert.AnError }, true, true)
 	command.AddFlag(flag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	os.Setenv("FOO", "thisIsNotAnInt")
 	defer os.Unsetenv("FOO")
 	exitCode := command.parseFlags(contextPtr, []string{})
@@ -68,7 +72,7 @@ func TestExitCodeParseFlagsInvalidEnvFlag(t *testing.T) {
 	clusterFlag := StringFlag(&result, "", "", "", "CB_CLUSTER", "", []string{},
 		func(Value) error { return assert.AnError }, true, true)
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	os.Setenv("CB_CLUSTER", "nonEmptyAddress")
 	defer os.Unsetenv("CB_CLUSTER")
 	exitCode := command.parseFlags(contextPtr, []string{})
@@ -79,7 +83,7 @@ func TestExitCodeParseFlagsInvalidEnvFlag(t *testing.T) {
 // flag (does not start with "-" or "--") was specified.
 func TestExitCodeParseFlagsNotFlag(t *testing.T) {
 	command := NewCommand("", "", "", func() {})
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"notFlag"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -88,7 +92,7 @@ func TestExitCodeParseFlagsNotFlag(t *testing.T) {
 // unknown flag was specified.
 func TestExitCodeParseFlagsUnknownFlag(t *testing.T) {
 	command := NewCommand("", "", "", func() {})
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"--unknownFlag"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -104,7 +108,7 @@ func TestExitCodeParseFlagsFlagAlreadySpecified1(t *testing.T) {
 	// this flag has already been found before we execute the parsing function.
 	clusterFlag.foundShort = true
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -117,7 +121,7 @@ func TestExitCodeParseFlagsFlagAlreadySpecified2(t *testing.T) {
 	clusterFlag := StringFlag(&result, "", "c", "cluster", "", "", []string{},
 		func(Value) error { return nil }, true, true)
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c", "address", "--cluster"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -130,7 +134,7 @@ func TestExitCodeParseFlagsOptHandlerError(t *testing.T) {
 	clusterFlag := StringFlag(&result, "", "c", "", "", "", []string{},
 		func(Value) error { return nil }, true, true)
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -143,7 +147,7 @@ func TestExitCodeParseFlagsFlagValueError(t *testing.T) {
 	clusterFlag := IntFlag(&result, 0, "c", "", "", "", []string{},
 		func(Value) error { return nil }, true, true)
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c", "stringNotInt"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -157,7 +161,7 @@ func TestExitCodeParseFlagsValidationError(t *testing.T) {
 	clusterFlag := StringFlag(&result, "", "c", "", "", "", []string{},
 		func(Value) error { return assert.AnError }, true, true)
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c", "address"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -170,7 +174,7 @@ func TestExitCodeParseFlagsHelp(t *testing.T) {
 	result := true
 	helpFlag := helpFlag(&result)
 	command.AddFlag(helpFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-h"})
 	require.Equal(t, ExitCodeSuccess, exitCode)
 }
@@ -186,7 +190,7 @@ func TestExitCodeParseFlagsNotAllRequired(t *testing.T) {
 		func(Value) error { return nil }, true, true)
 	command.AddFlag(clusterFlag)
 	command.AddFlag(missingRequiredFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c", "address"})
 	require.Equal(t, ExitCodeCLIUsageError, exitCode)
 }
@@ -199,7 +203,7 @@ func TestExitCodeParseFlagsSuccess(t *testing.T) {
 	clusterFlag := StringFlag(&result, "", "c", "", "", "", []string{},
 		func(Value) error { return nil }, true, true)
 	command.AddFlag(clusterFlag)
-	contextPtr := &Context{NewCLI("", ""), []string{}}
+	contextPtr := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 	exitCode := command.parseFlags(contextPtr, []string{"-c", "address"})
 	require.Equal(t, ExitCodeSuccess, exitCode)
 }
@@ -234,7 +238,7 @@ func TestParseLong(t *testing.T) {
 			command.AddFlag(BoolFlag(&ignoredB, false, "flag", "", "", "", []string{}, false))
 			command.AddFlag(StringFlag(&result, "", "", "result", "", "", []string{}, nil, false, true))
 
-			ctx := &Context{NewCLI("", ""), []string{}}
+			ctx := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 			exitCode := command.parseFlags(ctx, test.args)
 			require.Equal(t, test.exitCode, exitCode)
 			require.Equal(t, test.expected, result)
@@ -248,9 +252,198 @@ func TestFlagOptionValueStartsWithDash(t *testing.T) {
 	command := NewCommand("", "", "", func() {})
 	command.AddFlag(StringFlag(&foo, "", "f", "foo", "", "", []string{}, nil, false, true))
 
-	ctx := &Context{NewCLI("", ""), []string{}}
+	ctx := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
 
 	exitCode := command.parseFlags(ctx, []string{"--foo", "-this-is-not-a-flag"})
 	require.Equal(t, ExitCode(0), exitCode)
 	require.Equal(t, "-this-is-not-a-flag", foo)
 }
+
+func TestRedactMessage(t *testing.T) {
+	var password string
+	flag := StringFlag(&password, "", "p", "password", "", "", []string{}, nil, false, false)
+
+	require.Equal(t, "password e is too short", flag.redactMessage("password e is too short", "e"))
+
+	flag.SetSecret(true)
+	require.Equal(t, "password ***** is too short", flag.redactMessage("password e is too short", "e"))
+	require.Equal(t, "*****: ***** is *****", flag.redactMessage("p@ss: p@ss is p@ss", "p@ss"))
+
+	// The value is replaced even when it is part of a longer word
+	require.Equal(t, "pw=*****x is invalid", flag.redactMessage("pw=abc123x is invalid", "abc123"))
+	require.Equal(t, "日本 ***** 日本*****", flag.redactMessage("日本 語 日本語", "語"))
+}
+
+func TestRedactValidatorError(t *testing.T) {
+	var password string
+
+	validator := func(value Value) error { return fmt.Errorf("pw=%sx is not allowed", value.String()) }
+	command := NewCommand("sub", "", "", func() {})
+	command.AddFlag(GenericPasswordFlag(&password, "", "p", "password", "", "", []string{}, validator, false, false))
+
+	cli := NewCLI("cb", "")
+	output := captureWriter(t, cli)
+
+	exitCode := command.parseFlags(&Context{cli: cli, prevCmds: []string{}}, []string{"-p", "abc123"})
+	require.Equal(t, ExitCodeCLIUsageError, exitCode)
+	require.Contains(t, output(), "pw=*****x is not allowed")
+	require.NotContains(t, output(), "abc123")
+}
+
+func TestSecretFlagFollowedByFlag(t *testing.T) {
+	var key, user string
+
+	parse := func(args ...string) ExitCode {
+		command := NewCommand("sub", "", "", func() {})
+		command.AddFlag(StringFlag(&key, "", "", "key", "", "", []string{}, nil, false, false).SetSecret(true))
+		command.AddFlag(StringFlag(&user, "", "u", "username", "", "", []string{}, nil, false, false))
+
+		return command.parseFlags(&Context{cli: NewCLI("cb", ""), prevCmds: []string{}}, args)
+	}
+
+	// The next argument is always the value of the flag, even when it looks like a flag
+	require.Equal(t, ExitCodeSuccess, parse("--key", "-u", "-u", "user"))
+	require.Equal(t, "-u", key)
+	require.Equal(t, "user", user)
+
+	require.Equal(t, ExitCodeSuccess, parse("--key", "-secret", "-u", "user"))
+	require.Equal(t, "-secret", key)
+	require.Equal(t, "user", user)
+}
+
+func TestRedactArgs(t *testing.T) {
+	var (
+		host, user, password, other string
+		verify                      bool
+	)
+
+	cli := NewCLI("cb", "")
+	sub := NewCommand("sub", "", "", func() {})
+	sub.AddFlag(HostFlag(&host, "", []string{}, false, false))
+	sub.AddFlag(UsernameFlag(&user, "", []string{}, false, false))
+	sub.AddFlag(PasswordFlag(&password, "", []string{"pass"}, false, false))
+	sub.AddFlag(NoSSLVerifyFlag(&verify, []string{}, false, false))
+	sub.AddFlag(StringFlag(&other, "", "", "key", "", "", []string{}, nil, false, false).SetSecret(true))
+	cli.AddCommand(sub)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{name: "Empty", args: []string{}, expected: []string{}},
+		{name: "NoSecrets", args: []string{"cb", "sub", "-c", "host", "-u", "user"},
+			expected: []string{"cb", "sub", "-c", "host", "-u", "user"}},
+		{name: "Short", args: []string{"cb", "sub", "-p", "secret"}, expected: []string{"cb", "sub", "-p", "*****"}},
+		{name: "LongEquals", args: []string{"cb", "sub", "--password=secret", "--no-ssl-verify", "-u", "user"},
+			expected: []string{"cb", "sub", "--password=*****", "--no-ssl-verify", "-u", "user"}},
+		{name: "Deprecated", args: []string{"cb", "sub", "--pass", "secret"},
+			expected: []string{"cb", "sub", "--pass", "*****"}},
+		{name: "MarkedSecret", args: []string{"cb", "sub", "--key", "secret"},
+			expected: []string{"cb", "sub", "--key", "*****"}},
+		{name: "WrongCommand", args: []string{"cb", "other", "-p", "secret"},
+			expected: []string{"cb", "other", "-p", "secret"}},
+		{name: "FollowedByFlag", args: []string{"cb", "sub", "-p", "-u", "user"},
+			expected: []string{"cb", "sub", "-p", "*****", "user"}},
+		{name: "ValueLikeFlag", args: []string{"cb", "sub", "-p", "-secret", "-u", "user"},
+			expected: []string{"cb", "sub", "-p", "*****", "-u", "user"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, cli.RedactArgs(test.args))
+		})
+	}
+}
+
+func TestConfirmedPasswordFlagPolicy(t *testing.T) {
+	var password string
+
+	// Each value is parsed by a new command, as it would be by a new run of the tool
+	parse := func(value string) ExitCode {
+		command := NewCommand("reset-password", "", "", func() {})
+		command.AddFlag(ConfirmedPasswordFlag(&password, "", "p", "password", "", "", []string{},
+			pwd.ConfirmOptions{Policy: pwd.BasicPolicy{MinLength: 8}}, nil, true, false))
+
+		return command.parseFlags(&Context{cli: NewCLI("cb", ""), prevCmds: []string{}}, []string{"-p", value})
+	}
+
+	require.Equal(t, ExitCodeCLIUsageError, parse("short"))
+	require.Equal(t, ExitCodeSuccess, parse("long enough"))
+	require.Equal(t, "long enough", password)
+}
+
+func TestUsageAnnotations(t *testing.T) {
+	var (
+		host, password string
+		threads        int
+		verify         bool
+	)
+
+	mockTerminalWidth(t, 0)
+
+	cli := NewCLI("cb", "")
+	cli.AddFlag(HostFlag(&host, "localhost", []string{"host"}, false, false))
+	cli.AddFlag(PasswordFlag(&password, "default", []string{}, false, false))
+	cli.AddFlag(IntFlag(&threads, 4, "t", "threads", "CB_THREADS", "The number of threads", []string{}, nil, false,
+		false))
+	cli.AddFlag(NoSSLVerifyFlag(&verify, []string{}, false, false))
+
+	require.Equal(t, "Optional Flags:\n\n"+
+		"  -c,--cluster                The hostname of the Couchbase cluster\n"+
+		"  -p,--password               The password of the Couchbase cluster\n"+
+		"  -t,--threads                The number of threads\n"+
+		"     --no-ssl-verify          Skips SSL verification of certificates against CA\n"+
+		"     --no-color               Disables colored output\n\n", cli.Usage())
+
+	cli.HelpAnnotations = AnnotateAll
+	require.Equal(t, "Optional Flags:\n\n"+
+		"  -c,--cluster                The hostname of the Couchbase cluster [default:\n"+
+		"                              localhost] [env: CB_CLUSTER] [deprecated: --host]\n"+
+		"  -p,--password               The password of the Couchbase cluster [env:\n"+
+		"                              CB_PASSWORD]\n"+
+		"  -t,--threads                The number of threads [default: 4] [env:\n"+
+		"                              CB_THREADS]\n"+
+		"     --no-ssl-verify          Skips SSL verification of certificates against CA\n"+
+		"     --no-color               Disables colored output\n\n", cli.Usage())
+
+	cli.HelpAnnotations = AnnotateDefault
+	require.Contains(t, cli.Usage(), "The number of threads [default: 4]\n")
+}
+
+func TestOutputWriters(t *testing.T) {
+	var (
+		name   string
+		force  bool
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+	)
+
+	cmd := NewCommand("bucket", "", "", func() {})
+	cmd.AddFlag(StringFlag(&name, "", "", "bucket", "", "The name of the bucket", []string{"name"}, nil, true, false))
+	cmd.AddFlag(BoolFlag(&force, false, "", "force", "", "Force the operation", []string{}, false))
+
+	cli := NewCLI("cb", "")
+	cli.Writer, cli.ErrWriter = &stdout, &stderr
+
+	ctx := &Context{cli: cli, prevCmds: []string{"cb"}}
+	require.Equal(t, ExitCodeSuccess, cmd.parse(ctx, []string{"--help"}))
+	require.Contains(t, stdout.String(), "cb bucket [<args>]")
+	require.Empty(t, stderr.String())
+
+	stdout.Reset()
+	cmd.help = false
+	cmd.Flags[2].foundLong = false
+
+	ctx = &Context{cli: cli, prevCmds: []string{"cb"}}
+	require.Equal(t, ExitCodeCLIUsageError, cmd.parse(ctx, []string{"--force"}))
+	require.Empty(t, stdout.String())
+	require.True(t, strings.HasPrefix(stderr.String(), "Flag required, but not specified: --bucket\n\ncb bucket"))
+
+	stderr.Reset()
+
+	ctx = &Context{cli: cli, prevCmds: []string{"cb"}}
+	require.Equal(t, ExitCodeSuccess, cmd.parse(ctx, []string{"--name", "default"}))
+	require.Empty(t, stdout.String())
+	require.Equal(t, "Warning: --name is deprecated, use -/--bucket\n", stderr.String())
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// MarkdownUsageTemplate is the template used by MarkdownUsageFormatter to render the documentation of a command.
+const MarkdownUsageTemplate = `# {{join .Path " "}}
+{{- with .Desc}}
+
+{{.}}
+{{- end}}
+
+## Synopsis
+
+~~~
+{{.Title}}
+~~~
+{{- with .LongDesc}}
+
+## Description
+
+{{.}}
+{{- end}}
+{{- with .Commands}}
+
+## Commands
+{{range .}}
+- **{{.Name}}**{{with .Desc}}: {{.}}{{end}}
+{{- end}}{{end}}
+{{- with .RequiredFlags}}
+
+## Required Flags
+{{range .}}
+- **{{.Names}}**{{with $.FlagDesc .}}: {{.}}{{end}}
+{{- end}}{{end}}
+{{- with .OptionalFlags}}
+
+## Optional Flags
+{{range .}}
+- **{{.Names}}**{{with $.FlagDesc .}}: {{.}}{{end}}
+{{- end}}{{end}}
+{{- range .Groups}}
+
+## {{.Name}}
+{{range .Flags}}
+- **{{.Names}}**{{with $.FlagDesc .}}: {{.}}{{end}}
+{{- end}}{{end}}
+{{- with .Examples}}
+
+## Examples
+{{- range .}}
+{{- with .Desc}}
+
+{{.}}
+{{- end}}
+
+~~~
+$ {{.CommandLine}}
+~~~
+{{- end}}{{end}}
+{{- with .ExitCodes}}
+
+## Exit Codes
+{{range .}}
+- **{{printf "%d" .Code}}**: {{.Desc}}
+{{- end}}{{end}}
+`
+
+// ManUsageTemplate is the template used by ManUsageFormatter to render the documentation of a command.
+const ManUsageTemplate = `.TH {{roff (join .Path "-")}} 1
+.SH NAME
+{{roff (join .Path "-")}}{{with .Desc}} \- {{roff .}}{{end}}
+.SH SYNOPSIS
+.nf
+{{roff .Title}}
+.fi
+{{- with .LongDesc}}
+.SH DESCRIPTION
+{{roff .}}
+{{- end}}
+{{- with .Commands}}
+.SH COMMANDS
+{{- range .}}
+.TP
+.B {{roff .Name}}
+{{- with .Desc}}
+{{roff .}}
+{{- end}}{{end}}{{end}}
+{{- with .RequiredFlags}}
+.SH REQUIRED FLAGS
+{{- range .}}
+.TP
+.B {{roff .Names}}
+{{- with $.FlagDesc .}}
+{{roff .}}
+{{- end}}{{end}}{{end}}
+{{- with .OptionalFlags}}
+.SH OPTIONAL FLAGS
+{{- range .}}
+.TP
+.B {{roff .Names}}
+{{- with $.FlagDesc .}}
+{{roff .}}
+{{- end}}{{end}}{{end}}
+{{- range .Groups}}
+.SH {{roff (upper .Name)}}
+{{- range .Flags}}
+.TP
+.B {{roff .Names}}
+{{- with $.FlagDesc .}}
+{{roff .}}
+{{- end}}{{end}}{{end}}
+{{- with .Examples}}
+.SH EXAMPLES
+{{- range .}}
+{{- with .Desc}}
+.PP
+{{roff .}}
+{{- end}}
+.PP
+.RS 4
+.nf
+$ {{roff .CommandLine}}
+.fi
+.RE
+{{- end}}{{end}}
+{{- with .ExitCodes}}
+.SH EXIT STATUS
+{{- range .}}
+.TP
+.B {{printf "%d" .Code}}
+{{roff .Desc}}
+{{- end}}{{end}}
+`
+
+var (
+	// MarkdownUsageFormatter renders the documentation of a command as Markdown, see GenerateDocs.
+	MarkdownUsageFormatter = &TemplateUsageFormatter{
+		tmpl: template.Must(template.New("markdown").Funcs(usageFuncs).Parse(MarkdownUsageTemplate)),
+	}
+
+	// ManUsageFormatter renders the documentation of a command as a man page, see GenerateDocs.
+	ManUsageFormatter = &TemplateUsageFormatter{
+		tmpl: template.Must(template.New("man").Funcs(usageFuncs).Parse(ManUsageTemplate)),
+	}
+)
+
+// GenerateDocs renders the documentation of the tool and each of its commands using the formatter, such as
+// MarkdownUsageFormatter or ManUsageFormatter, and passes it to write along with the path of the command. Hidden
+// commands and flags are left out, and the descriptions of the flags are annotated with everything the help can show.
+// The documentation of the tool lists all of its exit codes, including those registered using RegisterExitCode.
+func (c *CLI) GenerateDocs(formatter UsageFormatter, write func(path []string, doc string) error) error {
+	return c.generateDocs(c.rootCommand(nil), []string{c.Name}, formatter, write)
+}
+
+// WriteDocs writes the documentation rendered by GenerateDocs to a file in the directory for each command, named after
+// the path of the command joined by hyphens followed by the extension (e.g. "couchbase-cli-bucket-create.md").
+func (c *CLI) WriteDocs(dir, ext string, formatter UsageFormatter) error {
+	return c.GenerateDocs(formatter, func(path []string, doc string) error {
+		return ioutil.WriteFile(filepath.Join(dir, strings.Join(path, "-")+ext), []byte(doc), 0644)
+	})
+}
+
+// generateDocs renders the documentation of the command and its subcommands, path is the names of the commands which
+// lead to it including its own.
+func (c *CLI) generateDocs(cmd *Command, path []string, formatter UsageFormatter,
+	write func(path []string, doc string) error) error {
+	data := cmd.usageData(AnnotateAll, false, ioutil.Discard)
+	data.Title = strings.TrimSuffix(cmd.usageTitle(&Context{cli: c, prevCmds: path}), "\n\n")
+	data.Path = path
+	data.Width = TOTAL_LEN
+	if len(path) == 1 {
+		data.ExitCodes = c.ExitCodes()
+	}
+
+	doc, err := formatter.FormatUsage(data)
+	if err != nil {
+		return fmt.Errorf("unable to render the documentation of %s: %w", strings.Join(path, " "), err)
+	}
+
+	if err := write(path, doc); err != nil {
+		return err
+	}
+
+	for _, sub := range cmd.Commands {
+		if sub.Hidden {
+			continue
+		}
+
+		if err := c.generateDocs(sub, append(append([]string{}, path...), sub.Name), formatter, write); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// roff escapes the text for use in a man page, blank lines separate paragraphs.
+func roff(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(text), "\n")
+	for idx, line := range lines {
+		switch {
+		case strings.TrimSpace(line) == "":
+			lines[idx] = ".PP"
+		case strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'"):
+			lines[idx] = `\&` + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"errors"
+	goflag "flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// updateGolden rewrites the golden files with the generated documentation rather than comparing against them, run
+// "go test -run TestGenerateDocs -update" after changing the documentation templates.
+var updateGolden = goflag.Bool("update", false, "update the golden files")
+
+// docsTestCLI returns a CLI with subcommands, grouped flags and a hidden command used to test generating documentation.
+func docsTestCLI() *CLI {
+	var (
+		host, user, password, name, path string
+		threads                          int
+		verbose                          bool
+	)
+
+	cli := NewCLI("cb", "Manages a Couchbase cluster")
+	cli.RegisterExitCode(100, "The bucket already exists")
+	cli.AddFlag(BoolFlag(&verbose, false, "v", "verbose", "", "Log more detail", []string{}, false))
+
+	create := NewCommand("create", "Creates a bucket", "", func() {})
+	create.LongDesc = "Creates a bucket on the cluster, the bucket can be used once it is ready.\n\n" +
+		"The settings of the bucket are read from\n.cbrc if it exists."
+	create.Examples = []Example{
+		{CommandLine: "cb bucket create -c localhost -u admin -p password -n travel", Desc: "Create a bucket"},
+		{CommandLine: "cb bucket create -c localhost -u admin -p password -n beer --threads 8"},
+	}
+	create.AddFlag(HostFlag(&host, "", []string{}, true, false).SetGroup("Connection"))
+	create.AddFlag(UsernameFlag(&user, "", []string{}, true, false).SetGroup("Connection"))
+	create.AddFlag(PasswordFlag(&password, "", []string{}, true, false).SetGroup("Connection"))
+	create.AddFlag(StringFlag(&name, "", "n", "name", "CB_BUCKET", "The name of the bucket", []string{"bucket"}, nil,
+		true, false))
+	create.AddFlag(StringFlag(&path, `C:\data`, "", "data-path", "", "The path to store the data in", []string{}, nil,
+		false, false))
+	create.AddFlag(IntFlag(&threads, 4, "", "threads", "", "The number of threads to use", []string{}, nil, false,
+		false).SetGroup("Performance"))
+
+	bucket := NewCommand("bucket", "Manage buckets", "", nil)
+	bucket.AddCommand(create)
+	bucket.AddCommand(&Command{Name: "internal", Desc: "Not documented", Hidden: true})
+	cli.AddCommand(bucket)
+
+	return cli
+}
+
+func TestGenerateDocs(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter UsageFormatter
+		golden    string
+	}{
+		{name: "Markdown", formatter: MarkdownUsageFormatter, golden: "docs.md.golden"},
+		{name: "Man", formatter: ManUsageFormatter, golden: "docs.1.golden"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var docs strings.Builder
+			require.NoError(t, docsTestCLI().GenerateDocs(test.formatter, func(path []string, doc string) error {
+				fmt.Fprintf(&docs, "==> %s <==\n%s\n", strings.Join(path, " "), doc)
+				return nil
+			}))
+
+			golden := filepath.Join("testdata", test.golden)
+			if *updateGolden {
+				require.NoError(t, ioutil.WriteFile(golden, []byte(docs.String()), 0644))
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), docs.String())
+		})
+	}
+}
+
+func TestGenerateDocsErrors(t *testing.T) {
+	formatter, err := NewTemplateUsageFormatter("{{.Missing}}")
+	require.NoError(t, err)
+
+	err = docsTestCLI().GenerateDocs(formatter, func([]string, string) error { return nil })
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "unable to render the documentation of cb: "))
+
+	// Generating stops at the first error returned by write
+	writeErr := errors.New("disk full")
+	calls := 0
+	require.Equal(t, writeErr, docsTestCLI().GenerateDocs(MarkdownUsageFormatter, func([]string, string) error {
+		calls++
+		return writeErr
+	}))
+	require.Equal(t, 1, calls)
+}
+
+func TestWriteDocs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, docsTestCLI().WriteDocs(dir, ".md", MarkdownUsageFormatter))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+
+	require.Equal(t, []string{"cb-bucket-create.md", "cb-bucket.md", "cb.md"}, names)
+
+	doc, err := ioutil.ReadFile(filepath.Join(dir, "cb-bucket-create.md"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(doc), "# cb bucket create\n\nCreates a bucket\n"))
+}
+
+func TestRoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "Empty", text: "", expected: ""},
+		{name: "Plain", text: "Creates a bucket", expected: "Creates a bucket"},
+		{name: "Hyphens", text: "--name", expected: `\-\-name`},
+		{name: "Backslash", text: `C:\data`, expected: `C:\edata`},
+		{name: "Paragraphs", text: "First\n\nSecond", expected: "First\n.PP\nSecond"},
+		{name: "ControlLine", text: "See\n.cbrc and\n'quotes'", expected: "See\n\\&.cbrc and\n\\&'quotes'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, roff(test.text))
+		})
+	}
+}
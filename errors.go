@@ -0,0 +1,256 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The errors below are returned by ExecuteE when the command line cannot be parsed, they all exit with
+// ExitCodeCLIUsageError. Path is the names of the commands which were parsed before the error, and the values of secret
+// flags are always replaced by RedactedValue.
+
+// UnknownCommandError is returned when a subcommand does not exist.
+type UnknownCommandError struct {
+	Path []string
+	Name string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("Invalid subcommand `%s`", e.Name)
+}
+
+func (e *UnknownCommandError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// UnknownFlagError is returned when a flag does not exist.
+type UnknownFlagError struct {
+	Path []string
+	Flag string
+}
+
+func (e *UnknownFlagError) Error() string {
+	return fmt.Sprintf("Unknown flag: %s", e.Flag)
+}
+
+func (e *UnknownFlagError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// MissingRequiredError is returned when required flags have not been specified.
+type MissingRequiredError struct {
+	Path  []string
+	Flags []string
+}
+
+func (e *MissingRequiredError) Error() string {
+	lines := make([]string, 0, len(e.Flags))
+	for _, flag := range e.Flags {
+		lines = append(lines, "Flag required, but not specified: "+flag)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (e *MissingRequiredError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// DuplicateFlagError is returned when a flag is specified more than once, Deprecated is the deprecated name used for
+// the flag if there was one.
+type DuplicateFlagError struct {
+	Path       []string
+	Flag       string
+	Deprecated string
+}
+
+func (e *DuplicateFlagError) Error() string {
+	if e.Deprecated != "" {
+		return fmt.Sprintf("Argument for %s already specified by a deprecated flag (%s)", e.Flag, e.Deprecated)
+	}
+
+	return fmt.Sprintf("Argument for %s already specified", e.Flag)
+}
+
+func (e *DuplicateFlagError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// InvalidValueError is returned when the value of a flag cannot be parsed, Env is the environment variable the value
+// was read from if it was not given on the command line.
+type InvalidValueError struct {
+	Path  []string
+	Flag  string
+	Env   string
+	Value string
+	Err   error
+}
+
+func (e *InvalidValueError) Error() string {
+	if e.Env != "" {
+		return fmt.Sprintf("Unable to process value of %s for flag: %s. %s", e.Env, e.Flag, e.Err)
+	}
+
+	return fmt.Sprintf("Unable to process value for flag: %s. %s", e.Flag, e.Err)
+}
+
+func (e *InvalidValueError) Unwrap() error {
+	return e.Err
+}
+
+func (e *InvalidValueError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// ValidationError is returned when the value of a flag is rejected by its validator.
+type ValidationError struct {
+	Path  []string
+	Flag  string
+	Value string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// ConstraintError is returned when an argument is not in the form expected, such as a value given where a flag was
+// expected or a flag missing its value.
+type ConstraintError struct {
+	Path []string
+	Arg  string
+	Err  error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// ManualError is returned when the manual of a command cannot be shown, Err is nil if the command doesn't have one.
+type ManualError struct {
+	Path    []string
+	ManPage string
+	Err     error
+}
+
+func (e *ManualError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("No manual is available for `%s`", strings.Join(e.Path, " "))
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ManualError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ManualError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// PromptError is printed when the value of a flag cannot be read from the user, see CLI.PromptMissing. The flag is then
+// reported as missing by a MissingRequiredError.
+type PromptError struct {
+	Path []string
+	Flag string
+	Err  error
+}
+
+func (e *PromptError) Error() string {
+	return fmt.Sprintf("Unable to read value for %s: %s", e.Flag, e.Err)
+}
+
+func (e *PromptError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PromptError) ExitCode() ExitCode {
+	return ExitCodeCLIUsageError
+}
+
+// reportError records and prints an error which isn't caused by the arguments, so the usage isn't shown, returning the
+// exit code for a usage error.
+func (ctx *Context) reportError(err error) ExitCode {
+	ctx.err = err
+	ctx.printError("%s\n", err.Error())
+	return ExitCodeCLIUsageError
+}
+
+// missingProgramName reports that the arguments given to Execute don't start with the program name.
+func (ctx *Context) missingProgramName() ExitCode {
+	return ctx.reportError(&ConstraintError{Path: []string{ctx.cli.Name},
+		Err: errors.New("Expected the arguments to start with the program name")})
+}
+
+// parseError records and prints the error followed by the usage of the command, returning the exit code for a usage
+// error.
+func (c *Command) parseError(ctx *Context, err error) ExitCode {
+	ctx.err = err
+	ctx.printError("%s\n\n", err.Error())
+	fmt.Fprint(ctx.errOut(), c.errorUsage(ctx))
+	return ExitCodeCLIUsageError
+}
+
+// path returns a copy of the names of the commands parsed so far, for use in errors.
+func (ctx *Context) path() []string {
+	return append([]string{}, ctx.prevCmds...)
+}
+
+// invalidValueError returns an InvalidValueError for the flag with any secret values redacted.
+func (f *Flag) invalidValueError(ctx *Context, env, value string, err error) error {
+	return &InvalidValueError{
+		Path:  ctx.path(),
+		Flag:  f.name(),
+		Env:   env,
+		Value: f.redact(value),
+		Err:   f.redactError(err, value),
+	}
+}
+
+// validationError returns a ValidationError for the flag with any secret values redacted.
+func (f *Flag) validationError(ctx *Context, value string, err error) error {
+	return &ValidationError{
+		Path:  ctx.path(),
+		Flag:  f.name(),
+		Value: f.redact(value),
+		Err:   f.redactError(err, value, f.value.String()),
+	}
+}
+
+// redactError returns the error unchanged unless this is a secret flag and its message contains one of the values, in
+// which case an error with the values redacted from the message is returned.
+func (f *Flag) redactError(err error, values ...string) error {
+	if msg := f.redactMessage(err.Error(), values...); msg != err.Error() {
+		return errors.New(msg)
+	}
+
+	return err
+}
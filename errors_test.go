@@ -0,0 +1,180 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	path := []string{"cb", "bucket"}
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      string
+		expected error
+		message  string
+	}{
+		{
+			name:     "UnknownCommand",
+			args:     []string{"bucket", "edit"},
+			expected: &UnknownCommandError{Path: path, Name: "edit"},
+			message:  "Invalid subcommand `edit`",
+		},
+		{
+			name:     "UnknownFlag",
+			args:     []string{"bucket", "--name", "default", "--force"},
+			expected: &UnknownFlagError{Path: path, Flag: "--force"},
+			message:  "Unknown flag: --force",
+		},
+		{
+			name:     "MissingRequired",
+			args:     []string{"bucket", "--ram", "100"},
+			expected: &MissingRequiredError{Path: path, Flags: []string{"-n/--name"}},
+			message:  "Flag required, but not specified: -n/--name",
+		},
+		{
+			name:     "Duplicate",
+			args:     []string{"bucket", "--name", "default", "-n", "other"},
+			expected: &DuplicateFlagError{Path: path, Flag: "-n/--name"},
+			message:  "Argument for -n/--name already specified",
+		},
+		{
+			name:     "DuplicateDeprecated",
+			args:     []string{"bucket", "--bucket-name", "default", "-n", "other"},
+			expected: &DuplicateFlagError{Path: path, Flag: "-n/--name", Deprecated: "--bucket-name"},
+			message:  "Argument for -n/--name already specified by a deprecated flag (--bucket-name)",
+		},
+		{
+			name:     "InvalidValue",
+			args:     []string{"bucket", "--name", "default", "--ram", "lots"},
+			expected: &InvalidValueError{Path: path, Flag: "--ram", Value: "lots"},
+			message:  `Unable to process value for flag: --ram. strconv.ParseInt: parsing "lots": invalid syntax`,
+		},
+		{
+			name:     "InvalidValueEnv",
+			args:     []string{"bucket", "--name", "default"},
+			env:      "lots",
+			expected: &InvalidValueError{Path: path, Flag: "--ram", Env: "CB_RAM", Value: "lots"},
+			message:  `Unable to process value of CB_RAM for flag: --ram. strconv.ParseInt: parsing "lots": invalid syntax`,
+		},
+		{
+			name:     "Validation",
+			args:     []string{"bucket", "--name", "default", "--password", "abc"},
+			expected: &ValidationError{Path: path, Flag: "--password", Value: RedactedValue},
+			message:  "password ***** is too short",
+		},
+		{
+			name:     "ExpectedFlag",
+			args:     []string{"bucket", "--name", "default", "100"},
+			expected: &ConstraintError{Path: path, Arg: "100"},
+			message:  "Expected flag: 100",
+		},
+		{
+			name:     "MissingValue",
+			args:     []string{"bucket", "--name"},
+			expected: &ConstraintError{Path: path, Arg: "--name"},
+			message:  "Expected argument for option: --name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CB_RAM", test.env)
+
+			var (
+				name     string
+				ram      int
+				password string
+			)
+
+			tooShort := func(value Value) error {
+				if len(value.String()) < 6 {
+					return errors.New("password " + value.String() + " is too short")
+				}
+
+				return nil
+			}
+
+			bucket := NewCommand("bucket", "", "", func() {})
+			bucket.AddFlag(StringFlag(&name, "", "n", "name", "", "", []string{"bucket-name"}, nil, true, false))
+			bucket.AddFlag(IntFlag(&ram, 0, "", "ram", "CB_RAM", "", []string{}, nil, false, false))
+			bucket.AddFlag(GenericPasswordFlag(&password, "", "", "password", "", "", []string{}, tooShort, false,
+				false))
+
+			cli := NewCLI("cb", "")
+			cli.AddCommand(bucket)
+			output := captureWriter(t, cli)
+
+			err := cli.ExecuteE(context.Background(), append([]string{"cb"}, test.args...))
+			require.Equal(t, test.expected, withoutCause(err))
+			require.Equal(t, test.message, err.Error())
+			require.Equal(t, ExitCodeCLIUsageError, exitCodeFor(err))
+			require.Contains(t, output(), test.message+"\n\n")
+		})
+	}
+}
+
+// withoutCause returns a copy of the parse error without the error which caused it, so that it can be compared.
+func withoutCause(err error) error {
+	switch err := err.(type) {
+	case *InvalidValueError:
+		clone := *err
+		clone.Err = nil
+		return &clone
+	case *ValidationError:
+		clone := *err
+		clone.Err = nil
+		return &clone
+	case *ConstraintError:
+		clone := *err
+		clone.Err = nil
+		return &clone
+	}
+
+	return err
+}
+
+func TestExecuteERunError(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	cli := NewCLI("cb", "")
+	cli.RunE = func(context.Context, []string) error { return errFailed }
+	captureWriter(t, cli)
+
+	var force bool
+	cli.AddFlag(BoolFlag(&force, false, "", "force", "", "", []string{}, false))
+
+	require.Equal(t, errFailed, cli.ExecuteE(context.Background(), []string{"cb", "--force"}))
+	require.NoError(t, cli.ExecuteE(context.Background(), []string{"cb", "--help"}))
+}
+
+func TestManualError(t *testing.T) {
+	cli := NewCLI("cb", "")
+	cli.HelpCommand = true
+	cli.AddCommand(NewCommand("bucket", "", "", func() {}))
+	output := captureWriter(t, cli)
+
+	err := cli.ExecuteE(context.Background(), []string{"cb", "help", "--manual", "bucket"})
+	require.Equal(t, &ManualError{Path: []string{"cb", "bucket"}}, err)
+	require.Equal(t, ExitCodeCLIUsageError, exitCodeFor(err))
+	require.Equal(t, "No manual is available for `cb bucket`\n", output())
+
+	cause := errors.New("man not found")
+	err = &ManualError{Path: []string{"cb", "bucket"}, ManPage: "cb-bucket.1", Err: cause}
+	require.Equal(t, "man not found", err.Error())
+	require.ErrorIs(t, err, cause)
+}
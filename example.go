@@ -0,0 +1,90 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Example is an example use of a command which is shown in its help.
+type Example struct {
+	// CommandLine is the full command line including the program name, arguments are split using shell-like quoting.
+	CommandLine string
+
+	// Desc explains what the example does.
+	Desc string
+}
+
+// ExampleError is returned by CheckExamples when an example is not valid for the command tree.
+type ExampleError struct {
+	Path    []string
+	Example Example
+	Err     error
+}
+
+func (e ExampleError) Error() string {
+	return fmt.Sprintf("example for `%s` is invalid: `%s`: %s", strings.Join(e.Path, " "), e.Example.CommandLine,
+		e.Err.Error())
+}
+
+// CheckExamples checks that the examples of every command in the CLI are still valid by parsing them against a copy of
+// the command tree, in the same way as they would be when run. The examples must name existing commands and flags, give
+// values that pass validation for flags that need them and specify all of the required flags. Values of secret flags
+// may be left out as they would be prompted for. Environment variables are ignored and no commands are run; the
+// arguments of built in commands, and plugins, are not checked.
+func (c *CLI) CheckExamples() []error {
+	root := c.rootCommand(nil)
+	return c.checkExamples(root, []string{c.Name})
+}
+
+func (c *CLI) checkExamples(cmd *Command, path []string) []error {
+	errs := make([]error, 0)
+	for _, example := range cmd.Examples {
+		if err := c.checkArgs(example.CommandLine); err != nil {
+			errs = append(errs, ExampleError{path, example, err})
+		}
+	}
+
+	for _, sub := range cmd.Commands {
+		errs = append(errs, c.checkExamples(sub, append(append([]string{}, path...), sub.Name))...)
+	}
+
+	return errs
+}
+
+// checkArgs checks that the command line would be accepted by the CLI, without running anything.
+func (c *CLI) checkArgs(commandLine string) error {
+	args, err := splitCommandLine(commandLine)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] != c.Name {
+		args = append([]string{c.Name}, args...)
+	}
+
+	root, err := c.isolatedRoot()
+	if err != nil {
+		return err
+	}
+
+	ctx, args := c.newContext(context.Background(), root, args, ioutil.Discard, ioutil.Discard)
+	ctx.check = true
+
+	if exitCode := ctx.root.parse(ctx, args); ctx.err == nil && exitCode != ExitCodeSuccess {
+		return exitCode
+	}
+
+	return ctx.err
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exampleTestCLI returns a CLI with a bucket-create command which takes a host, password, name and type.
+func exampleTestCLI() *CLI {
+	var (
+		host, password, name, bucketType string
+		flush                            bool
+	)
+
+	cli := NewCLI("cb", "")
+	create := NewCommand("bucket-create", "Creates a bucket", "", func() {})
+	create.AddFlag(HostFlag(&host, "", []string{}, true, false))
+	create.AddFlag(PasswordFlag(&password, "", []string{}, false, false))
+	create.AddFlag(StringFlag(&name, "", "", "bucket", "", "", []string{}, nil, true, false))
+	create.AddFlag(EnumFlag(&bucketType, "couchbase", []string{"couchbase", "ephemeral"}, "", "bucket-type", "", "",
+		[]string{}, false, false))
+	create.AddFlag(BoolFlag(&flush, false, "", "enable-flush", "", "", []string{}, false))
+	cli.AddCommand(create)
+
+	return cli
+}
+
+func TestCheckExamples(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandLine string
+		valid       bool
+	}{
+		{name: "Valid", commandLine: "cb bucket-create -c localhost --bucket 'my bucket' --enable-flush", valid: true},
+		{name: "NoProgName", commandLine: "bucket-create -c localhost --bucket=default", valid: true},
+		{name: "PromptPassword", commandLine: "cb bucket-create -c localhost --bucket default -p", valid: true},
+		{name: "Choice", commandLine: "cb bucket-create -c localhost --bucket default --bucket-type ephemeral",
+			valid: true},
+		{name: "Help", commandLine: "cb bucket-create -h", valid: true},
+		{name: "UnknownCommand", commandLine: "cb bucket-edit -c localhost --bucket default"},
+		{name: "UnknownFlag", commandLine: "cb bucket-create -c localhost --bucket default --ram 100"},
+		{name: "MissingRequired", commandLine: "cb bucket-create -c localhost"},
+		{name: "MissingValue", commandLine: "cb bucket-create --bucket default -c"},
+		{name: "Repeated", commandLine: "cb bucket-create -c localhost --cluster localhost --bucket default"},
+		{name: "InvalidChoice", commandLine: "cb bucket-create -c localhost --bucket default --bucket-type memcached"},
+		{name: "Quoting", commandLine: "cb bucket-create -c localhost --bucket 'default"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cli := exampleTestCLI()
+			cli.Commands[0].AddExample(test.commandLine, "")
+
+			errs := cli.CheckExamples()
+			if test.valid {
+				require.Empty(t, errs)
+				return
+			}
+
+			require.Len(t, errs, 1)
+			require.IsType(t, ExampleError{}, errs[0])
+			require.Equal(t, []string{"cb", "bucket-create"}, errs[0].(ExampleError).Path)
+		})
+	}
+}
+
+func TestUsageExamples(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	cli := exampleTestCLI()
+	cli.LongDesc = "Creates a new bucket on the cluster.\n\nThe bucket is ready to use once the command returns."
+	cli.AddExample("cb bucket-create -c localhost --bucket default", "Create a bucket called default")
+	cli.AddExample("cb bucket-create -c localhost --bucket other", "")
+
+	require.Equal(t, "  bucket-create   Creates a bucket\n\n"+
+		"Optional Flags:\n\n"+
+		"     --no-color               Disables colored output\n\n"+
+		"Description:\n\n"+
+		"  Creates a new bucket on the cluster.\n\n"+
+		"  The bucket is ready to use once the command returns.\n\n"+
+		"Examples:\n\n"+
+		"  Create a bucket called default\n\n"+
+		"    $ cb bucket-create -c localhost --bucket default\n\n"+
+		"    $ cb bucket-create -c localhost --bucket other\n\n", cli.Usage())
+	require.Empty(t, cli.CheckExamples())
+}
+
+func TestCheckExamplesParsing(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandLine string
+		policy      RepeatPolicy
+		env         string
+		valid       bool
+	}{
+		{name: "Valid", commandLine: "cb bucket-create -c localhost --bucket default --ram 200", valid: true},
+		{name: "Validator", commandLine: "cb bucket-create -c localhost --bucket default --ram 50"},
+		{name: "RepeatLastWins", commandLine: "cb bucket-create -c localhost --ram 100 --bucket default --ram 200",
+			policy: RepeatLastWins, valid: true},
+		{name: "RepeatFirstWins", commandLine: "cb bucket-create -c localhost --ram 100 --bucket default --ram 200",
+			policy: RepeatFirstWins, valid: true},
+		{name: "RepeatError", commandLine: "cb bucket-create -c localhost --ram 100 --bucket default --ram 200",
+			policy: RepeatError},
+		{name: "InvalidValue", commandLine: "cb bucket-create -c localhost --bucket default --ram lots"},
+		{name: "EnvironmentIgnored", commandLine: "cb bucket-create -c localhost", env: "default"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CB_TEST_BUCKET", test.env)
+
+			var ram int
+			cli := exampleTestCLI()
+			cli.Commands[0].Flags[2].env = "CB_TEST_BUCKET"
+			cli.Commands[0].AddFlag(IntFlag(&ram, 100, "", "ram", "", "", []string{}, func(value Value) error {
+				if value.(Getter).Get().(int) < 100 {
+					return fmt.Errorf("must be at least 100")
+				}
+
+				return nil
+			}, false, false).SetRepeatPolicy(test.policy))
+			cli.Commands[0].AddExample(test.commandLine, "")
+
+			errs := cli.CheckExamples()
+			require.Equal(t, 100, ram)
+			if test.valid {
+				require.Empty(t, errs)
+				return
+			}
+
+			require.Len(t, errs, 1)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// Range of exit codes which can be registered by tools using RegisterExitCode.
+const (
+	MinUserExitCode ExitCode = 65
+	MaxUserExitCode ExitCode = 113
+)
+
+// ExitCodeInfo describes an exit code in the help output.
+type ExitCodeInfo struct {
+	Code ExitCode
+	Desc string
+}
+
+// standardExitCodes are the exit codes defined by cbflag, they cannot be registered again.
+var standardExitCodes = []ExitCodeInfo{
+	{ExitCodeSuccess, "Success"},
+	{ExitCodeCLIUsageError, "Command line usage error"},
+	{ExitCodeDataError, "Input data was incorrect"},
+	{ExitCodeNoInput, "An input file did not exist or was not readable"},
+	{ExitCodeUnavailable, "A required service is unavailable"},
+	{ExitCodeSoftwareError, "Internal software error"},
+	{ExitCodeIOError, "An error occurred whilst reading or writing a file"},
+	{ExitCodeTempFailure, "Temporary failure, retrying may succeed"},
+	{ExitCodeNoPermission, "Insufficient permission"},
+	{ExitCodeConfigError, "Configuration error"},
+	{ExitCodeInterrupted, "Interrupted"},
+}
+
+// RegisterExitCode declares an exit code used by the tool so that it is described in the help output. It panics if the
+// code is not in the range MinUserExitCode to MaxUserExitCode, or it is already defined by cbflag or the tool.
+func (c *CLI) RegisterExitCode(code ExitCode, desc string) {
+	if code < MinUserExitCode || code > MaxUserExitCode {
+		panic(fmt.Sprintf("exit code %d is outside of the range %d-%d", code, MinUserExitCode, MaxUserExitCode))
+	}
+
+	for _, info := range c.ExitCodes() {
+		if info.Code == code {
+			panic(fmt.Sprintf("exit code %d is already defined as %q", code, info.Desc))
+		}
+	}
+
+	c.exitCodes = append(c.exitCodes, ExitCodeInfo{Code: code, Desc: desc})
+}
+
+// ExitCodes returns the exit codes defined by cbflag along with those registered by the tool, sorted by code.
+func (c *CLI) ExitCodes() []ExitCodeInfo {
+	codes := append(append([]ExitCodeInfo{}, standardExitCodes...), c.exitCodes...)
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// Error allows an ExitCode to be returned from a RunE function, in which case the process exits with the code without
+// printing anything.
+func (e ExitCode) Error() string {
+	return fmt.Sprintf("exit code %d", e)
+}
+
+// ExitCoder is implemented by errors which choose the exit code of the process when returned from a RunE function.
+type ExitCoder interface {
+	error
+	ExitCode() ExitCode
+}
+
+// ExitError is an error which exits the process with the given code, the error is printed before exiting.
+type ExitError struct {
+	Code ExitCode
+	Err  error
+}
+
+// NewExitError returns an error which prints the formatted message and exits the process with the code.
+func NewExitError(code ExitCode, format string, a ...interface{}) *ExitError {
+	return &ExitError{Code: code, Err: fmt.Errorf(format, a...)}
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return e.Code.Error()
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExitError) ExitCode() ExitCode {
+	return e.Code
+}
+
+// exitCodeFor returns the exit code for an error returned from a RunE function. Errors which do not choose an exit
+// code are mapped from well known errors where possible, otherwise they are treated as an internal software error.
+func exitCodeFor(err error) ExitCode {
+	if err == nil {
+		return ExitCodeSuccess
+	}
+
+	var coder ExitCoder
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+
+	var code ExitCode
+	if errors.As(err, &code) {
+		return code
+	}
+
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ExitCodeInterrupted
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitCodeTempFailure
+	case errors.Is(err, fs.ErrNotExist):
+		return ExitCodeNoInput
+	case errors.Is(err, fs.ErrPermission):
+		return ExitCodeNoPermission
+	case IsTransient(err):
+		return ExitCodeTempFailure
+	case errors.As(err, &pathErr):
+		return ExitCodeIOError
+	}
+
+	return ExitCodeSoftwareError
+}
+
+// handleRunError prints the error returned from a RunE function and returns the exit code the process should exit
+// with.
+func (ctx *Context) handleRunError(err error) ExitCode {
+	code := exitCodeFor(err)
+	if err == nil {
+		return code
+	}
+
+	ctx.err = err
+
+	// Nothing is printed for bare exit codes, the command is expected to have reported the problem itself
+	if _, ok := err.(ExitCode); ok {
+		return code
+	}
+
+	if exitErr, ok := err.(*ExitError); ok && exitErr.Err == nil {
+		return code
+	}
+
+	// The user knows they interrupted the command so there is nothing to report
+	if code == ExitCodeInterrupted && errors.Is(err, context.Canceled) {
+		return code
+	}
+
+	ctx.printError("Error: %s\n", err.Error())
+	return code
+}
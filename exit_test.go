@@ -0,0 +1,156 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ExitCode
+	}{
+		{name: "Nil", expected: ExitCodeSuccess},
+		{name: "Plain", err: errors.New("failed"), expected: ExitCodeSoftwareError},
+		{name: "ExitCode", err: ExitCodeCLIUsageError, expected: ExitCodeCLIUsageError},
+		{name: "ExitError", err: NewExitError(75, "try again"), expected: 75},
+		{name: "Wrapped", err: fmt.Errorf("create: %w", NewExitError(77, "denied")), expected: 77},
+		{name: "WrappedExitCode", err: fmt.Errorf("create: %w", ExitCode(78)), expected: 78},
+		{name: "NotExist", err: fmt.Errorf("open: %w", fs.ErrNotExist), expected: ExitCodeNoInput},
+		{name: "Permission", err: &fs.PathError{Op: "open", Path: "f", Err: fs.ErrPermission},
+			expected: ExitCodeNoPermission},
+		{name: "PathError", err: &fs.PathError{Op: "write", Path: "f", Err: errors.New("disk full")},
+			expected: ExitCodeIOError},
+		{name: "Canceled", err: fmt.Errorf("list: %w", context.Canceled), expected: ExitCodeInterrupted},
+		{name: "Deadline", err: fmt.Errorf("list: %w", context.DeadlineExceeded), expected: ExitCodeTempFailure},
+		{name: "Transient", err: &TransientError{Err: errors.New("busy")}, expected: ExitCodeTempFailure},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, exitCodeFor(test.err))
+		})
+	}
+}
+
+func TestExecuteRunE(t *testing.T) {
+	type key struct{}
+
+	tests := []struct {
+		name     string
+		err      error
+		exitCode ExitCode
+		expected string
+	}{
+		{name: "Success"},
+		{name: "Error", err: errors.New("bucket not found"), exitCode: ExitCodeSoftwareError,
+			expected: "Error: bucket not found\n"},
+		{name: "ExitError", err: NewExitError(69, "cluster unavailable"), exitCode: 69,
+			expected: "Error: cluster unavailable\n"},
+		{name: "BareExitCode", err: ExitCode(75), exitCode: 75},
+		{name: "SilentExitError", err: &ExitError{Code: 75}, exitCode: 75},
+		{name: "Canceled", err: fmt.Errorf("list: %w", context.Canceled), exitCode: ExitCodeInterrupted},
+		{name: "Deadline", err: fmt.Errorf("list: %w", context.DeadlineExceeded), exitCode: ExitCodeTempFailure,
+			expected: "Error: list: context deadline exceeded\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				name string
+				path []string
+			)
+
+			create := NewCommand("create", "", "", nil)
+			create.AddFlag(StringFlag(&name, "", "", "bucket", "", "", []string{}, nil, true, false))
+			create.RunE = func(ctx context.Context, p []string) error {
+				require.Equal(t, "value", ctx.Value(key{}))
+				path = p
+				return test.err
+			}
+
+			cli := NewCLI("cb", "")
+			cli.AddCommand(create)
+			output := captureWriter(t, cli)
+
+			ctx := context.WithValue(context.Background(), key{}, "value")
+			require.Equal(t, test.exitCode, cli.Execute(ctx, []string{"cb", "create", "--bucket", "default"}))
+			require.Equal(t, []string{"cb", "create"}, path)
+			require.Equal(t, "default", name)
+			require.Equal(t, test.expected, output())
+		})
+	}
+}
+
+func TestExecuteNoArgs(t *testing.T) {
+	cli := NewCLI("cb", "")
+	output := captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{}))
+	require.Equal(t, "Expected the arguments to start with the program name\n", output())
+
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, cli.ExecuteE(context.Background(), nil), &constraintErr)
+
+	var stderr bytes.Buffer
+	result, err := cli.ExecuteIsolated(context.Background(), nil, ioutil.Discard, &stderr)
+	require.ErrorAs(t, err, &constraintErr)
+	require.Equal(t, ExitCodeCLIUsageError, result.ExitCode)
+	require.Equal(t, "Expected the arguments to start with the program name\n", stderr.String())
+}
+
+func TestRegisterExitCode(t *testing.T) {
+	cli := NewCLI("cb", "")
+	require.Panics(t, func() { cli.RegisterExitCode(64, "Too low") })
+	require.Panics(t, func() { cli.RegisterExitCode(114, "Too high") })
+	require.Panics(t, func() { cli.RegisterExitCode(ExitCodeUnavailable, "Standard") })
+
+	cli.RegisterExitCode(80, "Bucket not found")
+	require.Panics(t, func() { cli.RegisterExitCode(80, "Duplicate") })
+
+	codes := cli.ExitCodes()
+	require.Equal(t, ExitCodeInfo{Code: 80, Desc: "Bucket not found"}, codes[len(codes)-2])
+	require.Equal(t, ExitCodeInfo{Code: ExitCodeInterrupted, Desc: "Interrupted"}, codes[len(codes)-1])
+	require.Equal(t, ExitCodeInfo{Code: ExitCodeSuccess, Desc: "Success"}, codes[0])
+}
+
+func TestExitCodesUsage(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	cli := NewCLI("cb", "")
+	require.NotContains(t, cli.Usage(), "Exit Codes:")
+
+	cli.RegisterExitCode(80, "Bucket not found")
+	require.Contains(t, cli.Usage(), "Exit Codes:\n\n"+
+		"  0     Success\n"+
+		"  64    Command line usage error\n")
+	require.Contains(t, cli.Usage(), "  78    Configuration error\n"+
+		"  80    Bucket not found\n"+
+		"  130   Interrupted\n\n")
+
+	// Only the root command shows the exit codes
+	bucket := NewCommand("bucket", "", "", func() {})
+	cli.AddCommand(bucket)
+	output := captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "bucket"}))
+	require.NotContains(t, output(), "Exit Codes:")
+}
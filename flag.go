@@ -17,6 +17,9 @@ import (
 	"github.com/couchbase/cbflag/pwd"
 )
 
+// The help output is laid out as below, TOTAL_LEN is the default width which is used when stdout is not a terminal.
+// When it is a terminal the description column is widened or narrowed to fit (see helpWidth).
+//
 // |                                 TOTAL_LEN (80)                                 |
 // | PREFIX_LEN (2) |       FLAGS_LEN (25)       | POSTFIX_LEN (3) | USAGE_LEN (50) |
 // | PREFIX_LEN (2) | flags definition | padding | POSTFIX_LEN (3) | USAGE_LEN (50) |
@@ -27,6 +30,20 @@ const FLAGS_LEN int = 25
 const USAGE_LEN int = 50
 const TOTAL_LEN int = 80
 
+// RedactedValue is displayed in place of the value of a secret flag in any output generated by cbflag.
+const RedactedValue = "*****"
+
+// HelpAnnotation is a set of annotations which can be appended to the description of a flag in the help output.
+type HelpAnnotation uint8
+
+const (
+	AnnotateDefault    HelpAnnotation = 1 << iota // [default: X], never shown for secret flags
+	AnnotateEnv                                   // [env: CB_CLUSTER]
+	AnnotateDeprecated                            // [deprecated: --old]
+
+	AnnotateAll = AnnotateDefault | AnnotateEnv | AnnotateDeprecated
+)
+
 type ValidatorFn func(Value) error
 type OptionHandler func(string, string) (string, bool, error)
 
@@ -37,6 +54,7 @@ type Flag struct {
 	deprecated []string
 	desc       string
 	value      Value
+	defValue   string
 	validator  ValidatorFn
 	optHandler OptionHandler
 	foundLong  bool
@@ -46,6 +64,28 @@ type Flag struct {
 	required   bool
 	hidden     bool
 	isFlag     bool
+	secret     bool
+	choices    []string
+	group      string
+
+	// promptHandler, if set, returns the option handler to use in place of optHandler, it is given a prompter which
+	// writes to the error writer of the CLI being parsed.
+	promptHandler func(prompter *pwd.Prompter) OptionHandler
+
+	// repeat is what happens when the flag is given more than once, and restore resets the value to how it was before
+	// parsing. See repeat.go.
+	repeat  RepeatPolicy
+	restore func()
+
+	// reset sets the value back to the default, see Reset, and defaultValue is a copy of the default used to create
+	// the values of cloned flags.
+	reset        func()
+	defaultValue Value
+
+	// undo sets the value back to how it was before it was last parsed, it is cleared when the caller sets the value
+	// using Set. parsed is the value that parse left it with. See beginParse.
+	undo   func()
+	parsed string
 }
 
 func BoolFlag(result *bool, def bool, short, long, env, usage string, deprecated []string, hidden bool) *Flag {
@@ -89,6 +129,15 @@ func StringFlag(result *string, def, short, long, env, usage string, deprecated
 		DefaultOptionHandler, required, hidden, false)
 }
 
+// EnumFlag creates a string flag which only accepts one of the given choices.
+func EnumFlag(result *string, def string, choices []string, short, long, env, usage string, deprecated []string,
+	required, hidden bool) *Flag {
+	flag := varFlag(newStringValue(def, result), short, long, env, usage, deprecated, EnumValidator(choices),
+		DefaultOptionHandler, required, hidden, false)
+	flag.choices = choices
+	return flag
+}
+
 func StringMapFlag(result *map[string]string, def map[string]string, short, long, env, usage string,
 	deprecated []string, validator ValidatorFn, required, hidden bool) *Flag {
 	return varFlag(newStringMapValue(def, result), short, long, env, usage, deprecated, validator,
@@ -133,8 +182,23 @@ func PasswordFlag(result *string, def string, deprecated []string, required, hid
 
 func GenericPasswordFlag(result *string, def, short, long, env, usage string, deprecated []string,
 	validator ValidatorFn, required, hidden bool) *Flag {
-	return varFlag(newStringValue(def, result), short, long, env, usage, deprecated, validator, PasswordOptionHandler,
-		required, hidden, false)
+	flag := varFlag(newStringValue(def, result), short, long, env, usage, deprecated, validator, PasswordOptionHandler,
+		required, hidden, false).SetSecret(true)
+	flag.promptHandler = passwordOptionHandler
+	return flag
+}
+
+// ConfirmedPasswordFlag creates a secret flag which, when no value is given on the command line, prompts for the
+// password twice and checks it against the policy in opts. Useful for commands which set a password.
+func ConfirmedPasswordFlag(result *string, def, short, long, env, usage string, deprecated []string,
+	opts pwd.ConfirmOptions, validator ValidatorFn, required, hidden bool) *Flag {
+	flag := varFlag(newStringValue(def, result), short, long, env, usage, deprecated, validator,
+		ConfirmedPasswordOptionHandler(opts), required, hidden, false).SetSecret(true)
+	flag.promptHandler = func(prompter *pwd.Prompter) OptionHandler {
+		return confirmedPasswordOptionHandler(prompter, opts)
+	}
+
+	return flag
 }
 
 func CACertFlag(result *string, def string, deprecated []string, required, hidden bool) *Flag {
@@ -156,13 +220,19 @@ func helpFlag(result *bool) *Flag {
 
 func varFlag(value Value, short, long, env, usage string, deprecated []string, validator ValidatorFn,
 	optHandler OptionHandler, required, hidden, isFlag bool) *Flag {
-	return &Flag{
+	var reset func()
+	if value, ok := value.(snapshotter); ok {
+		reset = value.snapshot()
+	}
+
+	flag := &Flag{
 		short:      short,
 		long:       long,
 		env:        env,
 		deprecated: deprecated,
 		desc:       usage,
 		value:      value,
+		defValue:   value.String(),
 		validator:  validator,
 		optHandler: optHandler,
 		foundLong:  false,
@@ -172,7 +242,118 @@ func varFlag(value Value, short, long, env, usage string, deprecated []string, v
 		required:   required,
 		hidden:     hidden,
 		isFlag:     isFlag,
+		reset:      reset,
+	}
+
+	if value, ok := value.(cloner); ok {
+		flag.defaultValue = value.clone()
+	}
+
+	return flag
+}
+
+// clone returns a copy of the flag which has not been parsed, its value is set to the default and is not stored in the
+// variable the flag was created with. An error is returned if the value of the flag can't be copied.
+func (f *Flag) clone() (*Flag, error) {
+	def, ok := f.defaultValue.(cloner)
+	if !ok {
+		return nil, fmt.Errorf("Unable to copy the value of flag %s", f.name())
+	}
+
+	return &Flag{
+		short:         f.short,
+		long:          f.long,
+		env:           f.env,
+		deprecated:    f.deprecated,
+		desc:          f.desc,
+		value:         def.clone(),
+		defValue:      f.defValue,
+		validator:     f.validator,
+		optHandler:    f.optHandler,
+		required:      f.required,
+		hidden:        f.hidden,
+		isFlag:        f.isFlag,
+		secret:        f.secret,
+		choices:       f.choices,
+		group:         f.group,
+		promptHandler: f.promptHandler,
+		repeat:        f.repeat,
+		defaultValue:  f.defaultValue,
+	}, nil
+}
+
+// SetSecret marks the flag as holding a secret (e.g. a password), the value of a secret flag is replaced by
+// RedactedValue in all output generated by cbflag.
+func (f *Flag) SetSecret(secret bool) *Flag {
+	f.secret = secret
+	return f
+}
+
+// SetGroup assigns the flag to a named group (e.g. "Connection"), the flags in each group are shown in their own
+// section of the help.
+func (f *Flag) SetGroup(group string) *Flag {
+	f.group = group
+	return f
+}
+
+// Group returns the name of the group the flag belongs to, or an empty string if it is not in a group.
+func (f *Flag) Group() string {
+	return f.group
+}
+
+// IsSecret returns whether the flag holds a secret value.
+func (f *Flag) IsSecret() bool {
+	return f.secret
+}
+
+// redact returns RedactedValue in place of the given value if this is a secret flag.
+func (f *Flag) redact(value string) string {
+	if !f.secret || value == "" {
+		return value
+	}
+
+	return RedactedValue
+}
+
+// redactMessage replaces the given values in the message if this is a secret flag, it should be used for messages which
+// may contain the value such as errors returned by validators. Every occurrence is replaced, even inside a longer word,
+// so that no part of the message can reveal the value.
+func (f *Flag) redactMessage(msg string, values ...string) string {
+	if !f.secret {
+		return msg
+	}
+
+	for _, value := range values {
+		if value != "" {
+			msg = strings.ReplaceAll(msg, value, RedactedValue)
+		}
+	}
+
+	return msg
+}
+
+// name returns the name of the flag as it would be specified on the command line, preferring the long form.
+func (f *Flag) name() string {
+	if f.long != "" {
+		return "--" + f.long
+	}
+
+	return "-" + f.short
+}
+
+// names returns the short and long names of the flag as they would be specified on the command line, for example
+// "-c/--cluster".
+func (f *Flag) names() string {
+	names := make([]string, 0, 2)
+	if f.short != "" {
+		names = append(names, "-"+f.short)
+	}
+
+	if f.long != "" {
+		names = append(names, "--"+f.long)
 	}
+
+	return strings.Join(names, "/")
 }
 
 func (f *Flag) found() bool {
@@ -207,38 +388,82 @@ func (f *Flag) validate() error {
 	return f.validator(f.value)
 }
 
-func (f *Flag) usageString() string {
+// usageString returns the help for the flag wrapped to the given total width, with the flag names styled if enabled.
+func (f *Flag) usageString(width int, annotations HelpAnnotation, style styler) string {
 	if f.hidden {
 		return ""
 	}
 
 	s := ""
-	lines := f.splitDescription()
+	descCol := PREFIX_LEN + FLAGS_LEN + POSTFIX_LEN
+	lines := wrapText(f.annotatedDesc(annotations), width-descCol)
 
+	prePadding := strings.Repeat(" ", PREFIX_LEN)
 	flagsStr := f.flagsHelpString()
-	if len(f.long) > FLAGS_LEN {
-		prePadding := strings.Repeat(" ", PREFIX_LEN)
+	postPaddingLen := FLAGS_LEN + POSTFIX_LEN - displayWidth(flagsStr)
+	flagsStr = style.flag(flagsStr)
+	if postPaddingLen < 0 {
 		s += fmt.Sprintf("%s%s\n", prePadding, flagsStr)
-		s += fmt.Sprintf("%s%s\n", strings.Repeat(" ", TOTAL_LEN-USAGE_LEN), lines[0])
 	} else {
-		prePadding := strings.Repeat(" ", PREFIX_LEN)
-		postPaddingLen := FLAGS_LEN + POSTFIX_LEN - len(flagsStr)
-		if postPaddingLen < 0 {
-			s += fmt.Sprintf("%s%s\n", prePadding, flagsStr)
-			s += fmt.Sprintf("%s%s\n", strings.Repeat(" ", PREFIX_LEN+FLAGS_LEN+POSTFIX_LEN), lines[0])
-		} else {
-			s += fmt.Sprintf("%s%s%s%s\n", prePadding, flagsStr, strings.Repeat(" ", postPaddingLen), lines[0])
-		}
-
+		s += strings.TrimRight(fmt.Sprintf("%s%s%s%s", prePadding, flagsStr, strings.Repeat(" ", postPaddingLen),
+			lines[0]), " ") + "\n"
+		lines = lines[1:]
 	}
 
-	for i := 1; i < len(lines); i++ {
-		s += fmt.Sprintf("%s%s\n", strings.Repeat(" ", TOTAL_LEN-USAGE_LEN-1), lines[i])
+	for _, line := range lines {
+		s += strings.TrimRight(strings.Repeat(" ", descCol)+line, " ") + "\n"
 	}
 
 	return s
 }
 
+// annotatedDesc returns the description of the flag followed by the requested annotations.
+func (f *Flag) annotatedDesc(annotations HelpAnnotation) string {
+	extra := make([]string, 0)
+
+	// Grouped flags are shown in their group rather than the required flags section, so are marked as required
+	if f.group != "" && f.required {
+		extra = append(extra, "[required]")
+	}
+
+	if annotations&AnnotateDefault != 0 && f.hasDefault() {
+		extra = append(extra, fmt.Sprintf("[default: %s]", f.defValue))
+	}
+
+	if annotations&AnnotateEnv != 0 && f.env != "" {
+		extra = append(extra, fmt.Sprintf("[env: %s]", f.env))
+	}
+
+	if annotations&AnnotateDeprecated != 0 && len(f.deprecated) > 0 {
+		extra = append(extra, fmt.Sprintf("[deprecated: %s]", f.deprecatedFlagsString()))
+	}
+
+	if len(extra) == 0 {
+		return f.desc
+	}
+
+	if f.desc == "" {
+		return strings.Join(extra, " ")
+	}
+
+	return f.desc + " " + strings.Join(extra, " ")
+}
+
+// hasDefault returns whether the flag has a default value worth showing in the help, zero values are omitted and the
+// default of a secret flag is never shown.
+func (f *Flag) hasDefault() bool {
+	if f.secret {
+		return false
+	}
+
+	switch f.defValue {
+	case "", "0", "false", "[]", "map[]", "\x00":
+		return false
+	}
+
+	return true
+}
+
 func (f *Flag) flagsHelpString() string {
 	if f.short != "" && f.long != "" {
 		return fmt.Sprintf("-%s,--%s", f.short, f.long)
@@ -268,23 +493,6 @@ func (f *Flag) deprecatedFlagsString() string {
 	return rv
 }
 
-func (f *Flag) splitDescription() []string {
-	desc := f.desc
-
-	line := ""
-	lines := make([]string, 0)
-	for _, char := range desc {
-		if len(line) >= 50 && char == ' ' {
-			lines = append(lines, line)
-			line = ""
-		}
-
-		line += string(char)
-	}
-
-	return append(lines, line)
-}
-
 func DefaultOptionHandler(opt, value string) (string, bool, error) {
 	if value == "" {
 		return value, false, fmt.Errorf("Expected argument for option: %s", opt)
@@ -294,11 +502,45 @@ func DefaultOptionHandler(opt, value string) (string, bool, error) {
 }
 
 func PasswordOptionHandler(opt, value string) (string, bool, error) {
-	if value == "" {
-		fmt.Printf("Password for %s: ", opt)
-		password, err := pwd.GetPasswd()
-		return string(password), false, err
+	return passwordOptionHandler(pwd.NewPrompter())(opt, value)
+}
+
+// passwordOptionHandler returns an option handler which uses the prompter to ask for the password if no value is
+// given.
+func passwordOptionHandler(prompter *pwd.Prompter) OptionHandler {
+	return func(opt, value string) (string, bool, error) {
+		if value == "" {
+			password, err := prompter.Prompt(fmt.Sprintf("Password for %s: ", opt))
+			return string(password), false, err
+		}
+
+		return value, true, nil
 	}
+}
 
-	return value, true, nil
+// ConfirmedPasswordOptionHandler returns an option handler which prompts for the password to be entered twice if no
+// value is given. Passwords given on the command line are checked against the policy in opts.
+func ConfirmedPasswordOptionHandler(opts pwd.ConfirmOptions) OptionHandler {
+	return confirmedPasswordOptionHandler(pwd.NewPrompter(), opts)
+}
+
+func confirmedPasswordOptionHandler(prompter *pwd.Prompter, opts pwd.ConfirmOptions) OptionHandler {
+	return func(opt, value string) (string, bool, error) {
+		if value == "" {
+			if opts.Prompt == "" {
+				opts.Prompt = fmt.Sprintf("Password for %s: ", opt)
+			}
+
+			password, err := prompter.GetPasswdConfirmed(opts)
+			return string(password), false, err
+		}
+
+		if opts.Policy != nil {
+			if err := opts.Policy.Check([]byte(value)); err != nil {
+				return value, true, err
+			}
+		}
+
+		return value, true, nil
+	}
 }
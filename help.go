@@ -0,0 +1,109 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couchbase/cbflag/man"
+)
+
+// newHelpCommand returns the built in help command, its arguments name the command to show the help for rather than
+// being its subcommands so it isn't parsed in the usual way.
+func newHelpCommand() *Command {
+	var manual, all bool
+
+	cmd := NewCommand("help", "Shows the help for a command", "", nil)
+	cmd.AddFlag(BoolFlag(&manual, false, "", "manual", "", "Shows the manual for the command", []string{}, false))
+	cmd.AddFlag(BoolFlag(&all, false, "a", "all", "", "Includes hidden commands", []string{}, false))
+	cmd.AddExample("help bucket-create", "Show the help for the bucket-create command")
+
+	cmd.builtin = func(ctx *Context, args []string) ExitCode {
+		path, exitCode, ok := cmd.parseBuiltinArgs(ctx, args)
+		if !ok {
+			return exitCode
+		}
+
+		return cmd.showHelp(ctx, path, manual, all)
+	}
+
+	return cmd
+}
+
+// parseBuiltinArgs sets the flags of a built in command which are given in the arguments, the remaining arguments are
+// returned. False is returned if the command should not be run, along with the exit code, when the flags are invalid
+// or the help for the command has been printed.
+func (c *Command) parseBuiltinArgs(ctx *Context, args []string) ([]string, ExitCode, bool) {
+	ctx.prevCmds = append(ctx.prevCmds, c.Name)
+	c.initialize()
+
+	flags, rest := make([]string, 0), make([]string, 0)
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			flags = append(flags, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+
+	if exitCode, ok := c.setFlags(ctx, flags); !ok {
+		return nil, exitCode, false
+	}
+
+	if c.help {
+		fmt.Fprint(ctx.out(), c.fullUsage(ctx))
+		return nil, ExitCodeSuccess, false
+	}
+
+	return rest, ExitCodeSuccess, true
+}
+
+// showHelp resolves the command path from the root of the CLI and prints its usage, including hidden subcommands if all
+// is set, or opens its manual.
+func (c *Command) showHelp(ctx *Context, path []string, manual, all bool) ExitCode {
+	root := ctx.rootCommand()
+	cmd, resolved := root, []string{root.Name}
+	for _, name := range path {
+		var next *Command
+		for _, sub := range cmd.Commands {
+			if sub.Name == name {
+				next = sub
+				break
+			}
+		}
+
+		if next == nil {
+			// Got an invalid subcommand, exit with a non-zero exit code
+			return c.parseError(ctx, &UnknownCommandError{Path: resolved, Name: name})
+		}
+
+		cmd, resolved = next, append(resolved, name)
+	}
+
+	if manual {
+		if cmd.ManPage == "" {
+			return ctx.reportError(&ManualError{Path: resolved})
+		}
+
+		if err := man.ShowManual(ctx.cli.ManPath, cmd.ManPage); err != nil {
+			return ctx.reportError(&ManualError{Path: resolved, ManPage: cmd.ManPage, Err: err})
+		}
+
+		return ExitCodeSuccess
+	}
+
+	cmd.initialize()
+	resolvedCtx := *ctx
+	resolvedCtx.prevCmds = resolved
+	fmt.Fprint(ctx.out(), cmd.fullUsageShowHidden(&resolvedCtx, all))
+	return ExitCodeSuccess
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureWriter replaces the writer and error writer of the CLI with a buffer, the returned function returns
+// everything written to either so far.
+func captureWriter(t *testing.T, cli *CLI) func() string {
+	var output bytes.Buffer
+	cli.Writer, cli.ErrWriter = &output, &output
+	return output.String
+}
+
+// helpTestCLI returns a CLI with the help command enabled and a small tree of commands.
+func helpTestCLI() *CLI {
+	var name string
+
+	cli := NewCLI("cb", "")
+	cli.HelpCommand = true
+
+	bucket := NewCommand("bucket", "Manage buckets", "", func() {})
+	create := NewCommand("create", "Creates a bucket", "", func() {})
+	create.AddFlag(StringFlag(&name, "", "", "bucket", "", "The name of the bucket", []string{}, nil, true, false))
+	bucket.AddCommand(create)
+	bucket.AddCommand(&Command{Name: "compact", Desc: "Compacts a bucket", Hidden: true})
+	cli.AddCommand(bucket)
+
+	return cli
+}
+
+func TestHelpCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode ExitCode
+		expected string
+	}{
+		{name: "Root", args: []string{"help"}, expected: "cb [<command>] [<args>]\n\n" +
+			"  bucket   Manage buckets\n" +
+			"  help     Shows the help for a command\n\n" +
+			"Optional Flags:\n\n" +
+			"     --no-color               Disables colored output\n" +
+			"  -h,--help                   Prints the help message\n\n"},
+		{name: "Nested", args: []string{"help", "bucket", "create"}, expected: "cb bucket create [<args>]\n\n" +
+			"Required Flags:\n\n" +
+			"     --bucket                 The name of the bucket\n\n" +
+			"Optional Flags:\n\n" +
+			"  -h,--help                   Prints the help message\n\n"},
+		{name: "Hidden", args: []string{"help", "bucket"}, expected: "cb bucket [<command>] [<args>]\n\n" +
+			"  create   Creates a bucket\n\n" +
+			"Optional Flags:\n\n" +
+			"  -h,--help                   Prints the help message\n\n"},
+		{name: "ShowHidden", args: []string{"help", "--all", "bucket"}, expected: "cb bucket [<command>] [<args>]\n\n" +
+			"  create    Creates a bucket\n" +
+			"  compact   Compacts a bucket\n\n" +
+			"Optional Flags:\n\n" +
+			"  -h,--help                   Prints the help message\n\n"},
+		{name: "Invalid", args: []string{"help", "bucket", "edit"}, exitCode: ExitCodeCLIUsageError},
+		{name: "UnknownFlag", args: []string{"help", "--verbose"}, exitCode: ExitCodeCLIUsageError},
+		{name: "NoManual", args: []string{"help", "--manual", "bucket"}, exitCode: ExitCodeCLIUsageError,
+			expected: "No manual is available for `cb bucket`\n"},
+		{name: "ManualValue", args: []string{"help", "--manual=true", "bucket"}, exitCode: ExitCodeCLIUsageError,
+			expected: "No manual is available for `cb bucket`\n"},
+		{name: "NoManualValue", args: []string{"help", "--manual=false", "bucket"},
+			expected: "cb bucket [<command>] [<args>]\n\n" +
+				"  create   Creates a bucket\n\n" +
+				"Optional Flags:\n\n" +
+				"  -h,--help                   Prints the help message\n\n"},
+		{name: "InvalidValue", args: []string{"help", "--all=maybe", "bucket"}, exitCode: ExitCodeCLIUsageError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockTerminalWidth(t, 0)
+
+			cli := helpTestCLI()
+			output := captureWriter(t, cli)
+
+			ctx := &Context{cli: cli, prevCmds: []string{}}
+			require.Equal(t, test.exitCode, cli.rootCommand(nil).parse(ctx, test.args))
+			if test.expected != "" {
+				require.Equal(t, test.expected, output())
+			}
+		})
+	}
+}
+
+func TestHelpCommandIsolated(t *testing.T) {
+	cli := helpTestCLI()
+	output := captureWriter(t, cli)
+
+	// The help is sized for the writers of the execution rather than those of the CLI
+	var stdout, stderr bytes.Buffer
+	measured := make([]io.Writer, 0)
+	mockTerminalWidth(t, 0)
+	terminalWidth = func(writer io.Writer) (int, bool) {
+		measured = append(measured, writer)
+		return 0, false
+	}
+
+	result, err := cli.ExecuteIsolated(context.Background(), []string{"cb", "help", "bucket", "create"}, &stdout,
+		&stderr)
+	require.NoError(t, err)
+	require.Equal(t, ExitCodeSuccess, result.ExitCode)
+	require.Contains(t, stdout.String(), "cb bucket create [<args>]\n\n")
+	require.Equal(t, []io.Writer{&stdout}, measured)
+	require.Empty(t, stderr.String())
+	require.Empty(t, output())
+}
+
+func TestHelpCommandDisabled(t *testing.T) {
+	cli := helpTestCLI()
+	cli.HelpCommand = false
+	captureWriter(t, cli)
+
+	ctx := &Context{cli: cli, prevCmds: []string{}}
+	require.Equal(t, ExitCodeCLIUsageError, cli.rootCommand(nil).parse(ctx, []string{"help"}))
+}
+
+func TestHelpCommandDoesNotModifyCLI(t *testing.T) {
+	cli := helpTestCLI()
+	cli.rootCommand(nil)
+	require.Len(t, cli.Commands, 1)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// PreRunFunc is a hook which is run before the function of a command, path is the names of the commands which lead to
+// the command being run. Returning an error stops the command from being run.
+type PreRunFunc func(ctx context.Context, path []string) error
+
+// PostRunFunc is a hook which is run after the function of a command, err is the error returned from the command or an
+// earlier hook. The hook is run even if the command failed, as long as the pre hooks of the same command succeeded; an
+// error it returns is only used if there wasn't already one.
+type PostRunFunc func(ctx context.Context, path []string, err error) error
+
+// execute runs the function of the command surrounded by its hooks and the persistent hooks of the commands in cmds,
+// which are the commands leading to this one in tree order. The hooks are run in the order:
+//
+//	PersistentPreRun (root to command), PreRun, Run, PostRun, PersistentPostRun (command to root)
+//
+// When a pre hook fails the later pre hooks and the function are not run, and only the post hooks of the commands
+// whose pre hooks succeeded are run.
+func (c *Command) execute(ctx context.Context, path []string, cmds []*Command) error {
+	var (
+		err error
+		ran int
+	)
+
+	for _, cmd := range cmds {
+		if cmd.PersistentPreRun != nil {
+			if err = cmd.PersistentPreRun(ctx, path); err != nil {
+				break
+			}
+		}
+
+		ran++
+	}
+
+	if err == nil && c.PreRun != nil {
+		err = c.PreRun(ctx, path)
+	}
+
+	if err == nil {
+		err = c.runFunc(ctx, path)
+
+		if c.PostRun != nil {
+			err = firstError(err, c.PostRun(ctx, path, err))
+		}
+	}
+
+	for idx := ran - 1; idx >= 0; idx-- {
+		if cmds[idx].PersistentPostRun != nil {
+			err = firstError(err, cmds[idx].PersistentPostRun(ctx, path, err))
+		}
+	}
+
+	return err
+}
+
+// runFunc calls RunE if it is set, otherwise Run. When the context comes from Parse the context given to RunE is
+// cancelled on SIGINT or SIGTERM, the signals are only caught while it runs as Run can't be cancelled.
+func (c *Command) runFunc(ctx context.Context, path []string) error {
+	if c.RunE == nil {
+		c.Run()
+		return nil
+	}
+
+	if cancelOnSignal, _ := ctx.Value(cancelOnSignalKey{}).(bool); cancelOnSignal {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	return c.RunE(ctx, path)
+}
+
+// firstError returns err if it is not nil, otherwise next.
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+
+	return next
+}
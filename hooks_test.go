@@ -0,0 +1,152 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name     string
+		failIn   string
+		exitCode ExitCode
+		expected []string
+	}{
+		{
+			name: "Success",
+			expected: []string{"cb:persistent-pre", "bucket:persistent-pre", "create:persistent-pre", "create:pre",
+				"create:run", "create:post:<nil>", "create:persistent-post:<nil>", "bucket:persistent-post:<nil>",
+				"cb:persistent-post:<nil>"},
+		},
+		{
+			name:     "RunFails",
+			failIn:   "create:run",
+			exitCode: ExitCodeSoftwareError,
+			expected: []string{"cb:persistent-pre", "bucket:persistent-pre", "create:persistent-pre", "create:pre",
+				"create:run", "create:post:failed", "create:persistent-post:failed", "bucket:persistent-post:failed",
+				"cb:persistent-post:failed"},
+		},
+		{
+			name:     "PreRunFails",
+			failIn:   "bucket:persistent-pre",
+			exitCode: ExitCodeSoftwareError,
+			expected: []string{"cb:persistent-pre", "bucket:persistent-pre", "cb:persistent-post:failed"},
+		},
+		{
+			name:     "CommandPreRunFails",
+			failIn:   "create:pre",
+			exitCode: ExitCodeSoftwareError,
+			expected: []string{"cb:persistent-pre", "bucket:persistent-pre", "create:persistent-pre", "create:pre",
+				"create:persistent-post:failed", "bucket:persistent-post:failed", "cb:persistent-post:failed"},
+		},
+		{
+			name:     "PostRunFails",
+			failIn:   "create:post",
+			exitCode: ExitCodeSoftwareError,
+			expected: []string{"cb:persistent-pre", "bucket:persistent-pre", "create:persistent-pre", "create:pre",
+				"create:run", "create:post:<nil>", "create:persistent-post:failed", "bucket:persistent-post:failed",
+				"cb:persistent-post:failed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := make([]string, 0)
+			pre := func(name string) PreRunFunc {
+				return func(_ context.Context, path []string) error {
+					require.Equal(t, []string{"cb", "bucket", "create"}, path)
+					calls = append(calls, name)
+					if name == test.failIn {
+						return errFailed
+					}
+
+					return nil
+				}
+			}
+
+			post := func(name string) PostRunFunc {
+				return func(_ context.Context, path []string, err error) error {
+					calls = append(calls, fmt.Sprintf("%s:%v", name, err))
+					if name == test.failIn {
+						return errFailed
+					}
+
+					return nil
+				}
+			}
+
+			var force bool
+			create := NewCommand("create", "", "", nil)
+			create.AddFlag(BoolFlag(&force, false, "", "force", "", "", []string{}, false))
+			create.RunE = func(ctx context.Context, path []string) error {
+				calls = append(calls, "create:run")
+				if test.failIn == "create:run" {
+					return errFailed
+				}
+
+				return nil
+			}
+			create.PersistentPreRun, create.PreRun = pre("create:persistent-pre"), pre("create:pre")
+			create.PostRun, create.PersistentPostRun = post("create:post"), post("create:persistent-post")
+
+			bucket := NewCommand("bucket", "", "", nil)
+			bucket.AddCommand(create)
+			bucket.PersistentPreRun, bucket.PersistentPostRun = pre("bucket:persistent-pre"), post("bucket:persistent-post")
+			bucket.PreRun, bucket.PostRun = pre("bucket:pre"), post("bucket:post")
+
+			cli := NewCLI("cb", "")
+			cli.AddCommand(bucket)
+			cli.PersistentPreRun, cli.PersistentPostRun = pre("cb:persistent-pre"), post("cb:persistent-post")
+			output := captureWriter(t, cli)
+
+			require.Equal(t, test.exitCode, cli.Execute(context.Background(), []string{"cb", "bucket", "create", "--force"}))
+			require.Equal(t, test.expected, calls)
+			if test.exitCode != ExitCodeSuccess {
+				require.Equal(t, "Error: failed\n", output())
+			}
+		})
+	}
+}
+
+func TestRunCancelledOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent to the process")
+	}
+
+	ctx := context.WithValue(context.Background(), cancelOnSignalKey{}, true)
+	cmd := &Command{RunE: func(ctx context.Context, path []string) error {
+		process, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, process.Signal(os.Interrupt))
+
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	require.ErrorIs(t, cmd.runFunc(ctx, []string{"cb"}), context.Canceled)
+	require.NoError(t, ctx.Err())
+
+	// Run functions aren't given a context so the signals are never caught for them
+	var ran bool
+	cmd = NewCommand("bucket", "", "", func() { ran = true })
+	require.NoError(t, cmd.runFunc(ctx, []string{"cb", "bucket"}))
+	require.True(t, ran)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"io"
+)
+
+// ParseResult holds the values of the flags from an isolated execution, see ExecuteIsolated. Flags are looked up by
+// any of their names, with or without dashes (e.g. "cluster", "--cluster" or "-c"); the typed accessors return the zero
+// value if the flag does not exist or is of a different type.
+type ParseResult struct {
+	// ExitCode is the exit code the process would have exited with.
+	ExitCode ExitCode
+
+	ctx *Context
+}
+
+type parseResultKey struct{}
+
+// ResultFromContext returns the result of the isolated execution which is running the command, it is only available
+// to the RunE functions, hooks and middleware run by ExecuteIsolated.
+func ResultFromContext(ctx context.Context) (*ParseResult, bool) {
+	result, ok := ctx.Value(parseResultKey{}).(*ParseResult)
+	return result, ok
+}
+
+// ExecuteIsolated is the same as ExecuteE except that the command tree is copied before parsing, so the values of the
+// flags are stored in the returned result rather than the variables they were created with. Any number of isolated
+// executions can run at the same time, and at the same time as Execute, as they share no mutable state. Output is
+// written to stdout and stderr rather than the writers of the CLI. Nothing is read from the terminal of the process, so
+// values which would be prompted for, such as missing required flags or passwords, are reported as missing instead. An
+// error is returned, and nothing is parsed, if the value of a flag can't be copied.
+//
+// Run functions, which read the variables of the flags, do not see the parsed values so RunE functions should read
+// them using ResultFromContext instead. Calling ExecuteIsolated from a command being run by Execute on the same CLI
+// deadlocks, as Execute holds the lock which protects the commands while they are copied.
+func (c *CLI) ExecuteIsolated(ctx context.Context, args []string, stdout, stderr io.Writer) (*ParseResult, error) {
+	root, err := c.isolatedRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ParseResult{}
+	ctx = context.WithValue(ctx, parseResultKey{}, result)
+
+	parseCtx, rest := c.newContext(ctx, root, args, stdout, stderr)
+	parseCtx.noPrompt = true
+	result.ctx = parseCtx
+	if len(args) == 0 {
+		result.ExitCode = parseCtx.missingProgramName()
+	} else {
+		result.ExitCode = parseCtx.root.parse(parseCtx, rest)
+	}
+
+	if parseCtx.err == nil && result.ExitCode != ExitCodeSuccess {
+		return result, result.ExitCode
+	}
+
+	return result, parseCtx.err
+}
+
+// isolatedRoot returns the root command with copies of the commands and flags of the CLI, so that parsing it does not
+// modify them. An error is returned if a flag can't be copied.
+func (c *CLI) isolatedRoot() (*Command, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	commands := make([]*Command, 0, len(c.Commands))
+	for _, cmd := range c.Commands {
+		cloned, err := cmd.clone()
+		if err != nil {
+			return nil, err
+		}
+
+		commands = append(commands, cloned)
+	}
+
+	flags := make([]*Flag, 0, len(c.Flags))
+	for _, flag := range c.Flags {
+		cloned, err := flag.clone()
+		if err != nil {
+			return nil, err
+		}
+
+		flags = append(flags, cloned)
+	}
+
+	return c.rootCommandWith(c.Run, commands, flags), nil
+}
+
+// Path returns the names of the commands which were parsed, including the program name.
+func (r *ParseResult) Path() []string {
+	return r.ctx.path()
+}
+
+// flag returns the flag of the command which was run with the given name.
+func (r *ParseResult) flag(name string) *Flag {
+	if r.ctx == nil || len(r.ctx.cmds) == 0 {
+		return nil
+	}
+
+	flag, _ := r.ctx.cmds[len(r.ctx.cmds)-1].findFlagByName(name)
+	return flag
+}
+
+// IsSet returns whether the flag was given on the command line or through its environment variable.
+func (r *ParseResult) IsSet(name string) bool {
+	flag := r.flag(name)
+	return flag != nil && flag.found()
+}
+
+// Value returns the value of the flag, false is returned if there isn't a flag with the name.
+func (r *ParseResult) Value(name string) (interface{}, bool) {
+	flag := r.flag(name)
+	if flag == nil {
+		return nil, false
+	}
+
+	getter, ok := flag.value.(Getter)
+	if !ok {
+		return flag.value.String(), true
+	}
+
+	return getter.Get(), true
+}
+
+// String returns the value of a string flag, or the string form of the value for other flags.
+func (r *ParseResult) String(name string) string {
+	flag := r.flag(name)
+	if flag == nil {
+		return ""
+	}
+
+	return flag.value.String()
+}
+
+func (r *ParseResult) Bool(name string) bool {
+	value, _ := r.Value(name)
+	b, _ := value.(bool)
+	return b
+}
+
+func (r *ParseResult) Int(name string) int {
+	value, _ := r.Value(name)
+	i, _ := value.(int)
+	return i
+}
+
+func (r *ParseResult) Int64(name string) int64 {
+	value, _ := r.Value(name)
+	i, _ := value.(int64)
+	return i
+}
+
+func (r *ParseResult) Uint(name string) uint {
+	value, _ := r.Value(name)
+	i, _ := value.(uint)
+	return i
+}
+
+func (r *ParseResult) Uint64(name string) uint64 {
+	value, _ := r.Value(name)
+	i, _ := value.(uint64)
+	return i
+}
+
+func (r *ParseResult) Float64(name string) float64 {
+	value, _ := r.Value(name)
+	f, _ := value.(float64)
+	return f
+}
+
+func (r *ParseResult) Rune(name string) rune {
+	value, _ := r.Value(name)
+	c, _ := value.(rune)
+	return c
+}
+
+func (r *ParseResult) IntArray(name string) []int {
+	value, _ := r.Value(name)
+	i, _ := value.([]int)
+	return i
+}
+
+func (r *ParseResult) StringMap(name string) map[string]string {
+	value, _ := r.Value(name)
+	m, _ := value.(map[string]string)
+	return m
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolatedTestCLI returns a CLI with a "bucket create" command, the RunE function of which sends the parsed values to
+// the channel along with the variables of the name and port flags.
+func isolatedTestCLI(results chan<- string) (*CLI, *string, *[]int) {
+	var (
+		name  string
+		ports []int
+		ram   int
+		force bool
+	)
+
+	create := NewCommand("create", "", "", nil)
+	create.AddFlag(StringFlag(&name, "", "n", "name", "", "", []string{}, nil, true, false))
+	create.AddFlag(IntArrayFlag(&ports, []int{8091}, "", "port", "", "", []string{}, nil, false, false))
+	create.AddFlag(IntFlag(&ram, 100, "", "ram", "", "", []string{}, nil, false, false))
+	create.AddFlag(BoolFlag(&force, false, "", "force", "", "", []string{}, false))
+	create.RunE = func(ctx context.Context, path []string) error {
+		result, ok := ResultFromContext(ctx)
+		if !ok {
+			// Shared executions store the values in the variables
+			results <- fmt.Sprintf("%s %v %d %t", name, ports, ram, force)
+			return nil
+		}
+
+		results <- fmt.Sprintf("%s %v %d %t", result.String("name"), result.IntArray("port"), result.Int("ram"),
+			result.Bool("force"))
+		return nil
+	}
+
+	bucket := NewCommand("bucket", "", "", nil)
+	bucket.AddCommand(create)
+
+	cli := NewCLI("cb", "")
+	cli.AddCommand(bucket)
+
+	return cli, &name, &ports
+}
+
+func TestExecuteIsolated(t *testing.T) {
+	results := make(chan string, 1)
+	cli, name, ports := isolatedTestCLI(results)
+
+	var stdout, stderr bytes.Buffer
+	result, err := cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "create", "-n", "travel",
+		"--port", "1", "--force"}, &stdout, &stderr)
+	require.NoError(t, err)
+	require.Equal(t, ExitCodeSuccess, result.ExitCode)
+	require.Equal(t, []string{"cb", "bucket", "create"}, result.Path())
+	require.Equal(t, "travel [8091 1] 100 true", <-results)
+
+	require.Equal(t, "travel", result.String("--name"))
+	require.Equal(t, "travel", result.String("-n"))
+	require.True(t, result.IsSet("name"))
+	require.False(t, result.IsSet("ram"))
+	require.Equal(t, 100, result.Int("ram"))
+	require.Equal(t, 0, result.Int("name"))
+
+	value, ok := result.Value("port")
+	require.True(t, ok)
+	require.Equal(t, []int{8091, 1}, value)
+
+	_, ok = result.Value("missing")
+	require.False(t, ok)
+
+	// The variables the flags were created with are not modified
+	require.Equal(t, "", *name)
+	require.Equal(t, []int{8091}, *ports)
+	require.Empty(t, stdout.String())
+	require.Empty(t, stderr.String())
+}
+
+func TestExecuteIsolatedError(t *testing.T) {
+	cli, _, _ := isolatedTestCLI(nil)
+
+	var stdout, stderr bytes.Buffer
+	result, err := cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "create", "--ram", "lots"},
+		&stdout, &stderr)
+
+	var invalid *InvalidValueError
+	require.ErrorAs(t, err, &invalid)
+	require.Equal(t, ExitCodeCLIUsageError, result.ExitCode)
+	require.Empty(t, stdout.String())
+	require.Contains(t, stderr.String(), "Unable to process value for flag: --ram.")
+
+	result, err = cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "create", "--help"}, &stdout,
+		&stderr)
+	require.NoError(t, err)
+	require.Equal(t, ExitCodeSuccess, result.ExitCode)
+	require.Contains(t, stdout.String(), "cb bucket create [<args>]")
+}
+
+func TestExecuteIsolatedConcurrently(t *testing.T) {
+	const count = 50
+
+	results := make(chan string, count*2)
+	cli, _, _ := isolatedTestCLI(results)
+	cli.Writer, cli.ErrWriter = ioutil.Discard, ioutil.Discard
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+
+			var stdout, stderr bytes.Buffer
+			result, err := cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "create", "--name",
+				"isolated-" + strconv.Itoa(i), "--port", strconv.Itoa(i), "--ram", strconv.Itoa(i)}, &stdout, &stderr)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []int{8091, i}, result.IntArray("port"))
+				assert.Equal(t, i, result.Int("ram"))
+			}
+		}(i)
+
+		// Shared executions can run at the same time as isolated ones
+		go func(i int) {
+			defer wg.Done()
+			assert.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "bucket", "create",
+				"--name", "shared-" + strconv.Itoa(i), "--force"}))
+		}(i)
+	}
+
+	wg.Wait()
+	close(results)
+
+	seen := make(map[string]bool)
+	for result := range results {
+		seen[result] = true
+	}
+
+	require.Len(t, seen, count*2)
+	for i := 0; i < count; i++ {
+		require.True(t, seen[fmt.Sprintf("isolated-%d [8091 %d] %d false", i, i, i)])
+		require.True(t, seen[fmt.Sprintf("shared-%d [8091] 100 true", i)])
+	}
+}
+
+func TestExecuteIsolatedUncopyableFlag(t *testing.T) {
+	var name string
+
+	cmd := NewCommand("bucket", "", "", nil)
+	cmd.RunE = func(context.Context, []string) error { return nil }
+	cmd.AddFlag(StringFlag(&name, "", "", "name", "", "", []string{}, nil, false, false))
+	cmd.AddFlag(&Flag{long: "custom", value: newStringValue("", new(string))})
+
+	cli := NewCLI("cb", "")
+	cli.AddCommand(cmd)
+
+	result, err := cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "--name", "a"}, ioutil.Discard,
+		ioutil.Discard)
+	require.Nil(t, result)
+	require.EqualError(t, err, "Unable to copy the value of flag --custom")
+	require.Empty(t, name)
+}
+
+func TestExecuteIsolatedNoPrompt(t *testing.T) {
+	mockPrompt(t, "typed\n", true, "typed")
+
+	var name, password string
+
+	cmd := NewCommand("bucket", "", "", nil)
+	cmd.RunE = func(context.Context, []string) error { return nil }
+	cmd.AddFlag(StringFlag(&name, "", "", "name", "", "", []string{}, nil, true, false))
+	cmd.AddFlag(PasswordFlag(&password, "", []string{}, false, false))
+
+	cli := NewCLI("cb", "")
+	cli.PromptMissing = true
+	cli.Shell = &ShellConfig{}
+	cli.AddCommand(cmd)
+
+	// Missing required flags are reported rather than prompted for
+	var missingErr *MissingRequiredError
+	_, err := cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "-p", "pass"}, ioutil.Discard,
+		ioutil.Discard)
+	require.ErrorAs(t, err, &missingErr)
+	require.Equal(t, []string{"--name"}, missingErr.Flags)
+
+	// Passwords given without a value are reported rather than prompted for
+	var constraintErr *ConstraintError
+	_, err = cli.ExecuteIsolated(context.Background(), []string{"cb", "bucket", "--name", "a", "-p"}, ioutil.Discard,
+		ioutil.Discard)
+	require.ErrorAs(t, err, &constraintErr)
+	require.EqualError(t, err, "Expected argument for option: -p")
+
+	// The shell reads from the terminal so can't be run
+	_, err = cli.ExecuteIsolated(context.Background(), []string{"cb", "shell"}, ioutil.Discard, ioutil.Discard)
+	require.ErrorAs(t, err, &constraintErr)
+
+	require.Empty(t, name)
+	require.Empty(t, password)
+}
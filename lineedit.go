@@ -0,0 +1,280 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The keys understood by the line editor, see readLine.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// completion is a possible completion of a word, the description is shown alongside it when the completions are listed.
+type completion struct {
+	text string
+	desc string
+}
+
+// lineEditor reads lines from a terminal which is in raw mode. It supports moving the cursor, recalling previous lines
+// with the up and down keys and completing the word before the cursor with tab.
+type lineEditor struct {
+	in     *bufio.Reader
+	out    io.Writer
+	prompt string
+
+	// history is the previously entered lines, oldest first.
+	history []string
+
+	// complete returns the possible completions of the last word of the line, which is the text before the cursor.
+	complete func(line string) []completion
+
+	line []rune
+	pos  int
+}
+
+// readLine prints the prompt and reads a line, io.EOF is returned if Ctrl-D is pressed on an empty line. Pressing
+// Ctrl-C discards the line and an empty line is returned.
+func (e *lineEditor) readLine() (string, error) {
+	e.line, e.pos = e.line[:0], 0
+	historyIdx := len(e.history)
+	pending := ""
+
+	e.redraw()
+	for {
+		key, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", nil
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+
+			e.delete()
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.line)
+		case keyCtrlB:
+			e.left()
+		case keyCtrlF:
+			e.right()
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+		case keyCtrlU:
+			e.line, e.pos = append(e.line[:0], e.line[e.pos:]...), 0
+		case keyCtrlP, keyCtrlN:
+			historyIdx, pending = e.recall(historyIdx, key == keyCtrlP, pending)
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			historyIdx, pending = e.escape(historyIdx, pending)
+		default:
+			if key >= ' ' {
+				e.insert(key)
+			}
+		}
+
+		e.redraw()
+	}
+}
+
+// escape handles the escape sequences sent by the arrow, home, end and delete keys. The whole of a control sequence is
+// read, the same as when reading a password, so that the keys which aren't supported don't end up in the line.
+func (e *lineEditor) escape(historyIdx int, pending string) (int, string) {
+	next, _, err := e.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return historyIdx, pending
+	}
+
+	// Control Sequence Introducer: parameter and intermediate bytes followed by a final byte in 0x40-0x7E
+	var params []rune
+	key, _, err := e.in.ReadRune()
+	for err == nil && next == '[' && (key < 0x40 || key > 0x7e) {
+		params = append(params, key)
+		key, _, err = e.in.ReadRune()
+	}
+
+	if err != nil {
+		return historyIdx, pending
+	}
+
+	switch key {
+	case 'A':
+		return e.recall(historyIdx, true, pending)
+	case 'B':
+		return e.recall(historyIdx, false, pending)
+	case 'C':
+		e.right()
+	case 'D':
+		e.left()
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.line)
+	case '~':
+		if string(params) == "3" {
+			e.delete()
+		}
+	}
+
+	return historyIdx, pending
+}
+
+// recall replaces the line with the previous, or next, entry in the history. pending is the line which was being
+// entered before moving into the history, it is restored when moving past the newest entry.
+func (e *lineEditor) recall(historyIdx int, previous bool, pending string) (int, string) {
+	if historyIdx == len(e.history) {
+		pending = string(e.line)
+	}
+
+	if previous && historyIdx > 0 {
+		historyIdx--
+	} else if !previous && historyIdx < len(e.history) {
+		historyIdx++
+	} else {
+		return historyIdx, pending
+	}
+
+	line := pending
+	if historyIdx < len(e.history) {
+		line = e.history[historyIdx]
+	}
+
+	e.line, e.pos = []rune(line), len([]rune(line))
+	return historyIdx, pending
+}
+
+// completeWord completes the word before the cursor. A single completion is inserted followed by a space, otherwise
+// the longest common prefix of the completions is inserted; if that adds nothing the completions are listed.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+
+	head := string(e.line[:e.pos])
+	word := head[strings.LastIndexAny(head, " \t")+1:]
+
+	completions := e.complete(head)
+	if len(completions) == 0 {
+		return
+	}
+
+	if len(completions) == 1 {
+		e.insertString(strings.TrimPrefix(completions[0].text, word) + " ")
+		return
+	}
+
+	prefix := completions[0].text
+	for _, completion := range completions[1:] {
+		for !strings.HasPrefix(completion.text, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(prefix) > len(word) {
+		e.insertString(strings.TrimPrefix(prefix, word))
+		return
+	}
+
+	texts, descs := make([]string, 0, len(completions)), make([]string, 0, len(completions))
+	for _, completion := range completions {
+		texts, descs = append(texts, completion.text), append(descs, completion.desc)
+	}
+
+	// The terminal is in raw mode so each line needs a carriage return
+	rows := strings.ReplaceAll(alignedRows(texts, descs, helpWidth(e.out)), "\n", "\r\n")
+	fmt.Fprintf(e.out, "\r\n%s", rows)
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.pos+1:], e.line[e.pos:])
+	e.line[e.pos] = r
+	e.pos++
+}
+
+func (e *lineEditor) insertString(s string) {
+	for _, r := range s {
+		e.insert(r)
+	}
+}
+
+// delete removes the character under the cursor.
+func (e *lineEditor) delete() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+// left moves the cursor back a character, skipping over any combining characters as they don't take any space.
+func (e *lineEditor) left() {
+	for e.pos > 0 {
+		e.pos--
+		if runeWidth(e.line[e.pos]) > 0 {
+			return
+		}
+	}
+}
+
+// right moves the cursor forward a character, including any combining characters which follow it.
+func (e *lineEditor) right() {
+	if e.pos < len(e.line) {
+		e.pos++
+	}
+
+	for e.pos < len(e.line) && runeWidth(e.line[e.pos]) == 0 {
+		e.pos++
+	}
+}
+
+// redraw rewrites the prompt and line, clearing anything left over from before, and moves the cursor into place. The
+// cursor is moved by the display width of the text after it, see displayWidth, as wide characters take two columns.
+func (e *lineEditor) redraw() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.line))
+	if back := displayWidth(string(e.line[e.pos:])); back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
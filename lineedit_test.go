@@ -0,0 +1,120 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		err      error
+	}{
+		{name: "Simple", input: "bucket-list\r", expected: "bucket-list"},
+		{name: "LineFeed", input: "bucket-list\n", expected: "bucket-list"},
+		{name: "Backspace", input: "abc\x7f\r", expected: "ab"},
+		{name: "BackspaceAtStart", input: "\x7fab\r", expected: "ab"},
+		{name: "Unicode", input: "日本\x7f\r", expected: "日"},
+		{name: "Move", input: "abc\x02\x02X\x06Y\r", expected: "aXbYc"},
+		{name: "HomeEnd", input: "abc\x01X\x05Y\r", expected: "XabcY"},
+		{name: "Arrows", input: "abc\x1b[D\x1b[DX\x1b[CY\r", expected: "aXbYc"},
+		{name: "HomeEndKeys", input: "abc\x1b[HX\x1b[FY\r", expected: "XabcY"},
+		{name: "Delete", input: "abc\x1b[D\x1b[D\x1b[3~\r", expected: "ac"},
+		{name: "UnsupportedKey", input: "ab\x1b[15~c\r", expected: "abc"},
+		{name: "WideArrows", input: "日本\x1b[DX\r", expected: "日X本"},
+		{name: "CombiningArrows", input: "e\u0301x\x1b[D\x1b[DY\x1b[C\x1b[CZ\r", expected: "Ye\u0301xZ"},
+		{name: "KillToEnd", input: "abc\x1b[D\x0b\r", expected: "ab"},
+		{name: "KillToStart", input: "abc\x1b[D\x15\r", expected: "c"},
+		{name: "Interrupt", input: "abc\x03", expected: ""},
+		{name: "EndOfInput", input: "\x04", err: io.EOF},
+		{name: "DeleteWithCtrlD", input: "ab\x01\x04\r", expected: "b"},
+		{name: "Previous", input: "\x1b[A\x1b[A\r", expected: "bucket-list"},
+		{name: "PreviousPastStart", input: "\x10\x10\x10\r", expected: "bucket-list"},
+		{name: "Next", input: "\x10\x10\x0e\r", expected: "bucket-create"},
+		{name: "Pending", input: "ab\x1b[A\x1b[B\r", expected: "ab"},
+		{name: "CompleteSingle", input: "bucket-l\t-c\r", expected: "bucket-list -c"},
+		{name: "CompletePrefix", input: "b\t\r", expected: "bucket-"},
+		{name: "CompleteNone", input: "x\t\r", expected: "x"},
+		{name: "UnexpectedEnd", input: "abc", err: io.EOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			editor := &lineEditor{
+				in:      bufio.NewReader(strings.NewReader(test.input)),
+				out:     &output,
+				prompt:  "cb> ",
+				history: []string{"bucket-list", "bucket-create"},
+				complete: func(line string) []completion {
+					completions := make([]completion, 0)
+					for _, name := range []string{"bucket-create", "bucket-list"} {
+						if strings.HasPrefix(name, line) {
+							completions = append(completions, completion{text: name})
+						}
+					}
+
+					return completions
+				},
+			}
+
+			line, err := editor.readLine()
+			require.Equal(t, test.err, err)
+			require.Equal(t, test.expected, line)
+			require.True(t, strings.HasPrefix(output.String(), "\rcb> \x1b[K"))
+		})
+	}
+}
+
+func TestLineEditorCursorWidth(t *testing.T) {
+	var output bytes.Buffer
+	editor := &lineEditor{
+		in:     bufio.NewReader(strings.NewReader("日本e\u0301\x1b[D\x1b[D\r")),
+		out:    &output,
+		prompt: "cb> ",
+	}
+
+	line, err := editor.readLine()
+	require.NoError(t, err)
+	require.Equal(t, "日本e\u0301", line)
+
+	// The cursor is moved back by the width of the text after it, not the number of characters
+	require.Contains(t, output.String(), "\rcb> 日本e\u0301\x1b[K\x1b[1D")
+	require.Contains(t, output.String(), "\rcb> 日本e\u0301\x1b[K\x1b[3D")
+}
+
+func TestLineEditorListCompletions(t *testing.T) {
+	var output bytes.Buffer
+	editor := &lineEditor{
+		in:     bufio.NewReader(strings.NewReader("bucket-\t\r")),
+		out:    &output,
+		prompt: "cb> ",
+		complete: func(string) []completion {
+			return []completion{{text: "bucket-create", desc: "Creates a bucket"}, {text: "bucket-list"}}
+		},
+	}
+
+	mockTerminalWidth(t, 0)
+
+	line, err := editor.readLine()
+	require.NoError(t, err)
+	require.Equal(t, "bucket-", line)
+	require.Contains(t, output.String(), "\r\n  bucket-create   Creates a bucket\r\n  bucket-list\r\n\rcb> bucket-\x1b[K")
+}
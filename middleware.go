@@ -0,0 +1,194 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Invocation describes the command being run, it is passed to middleware.
+type Invocation struct {
+	// Path is the names of the commands which lead to the command being run, including the command itself.
+	Path    []string
+	Command *Command
+
+	// Flags maps the names of the flags which were given (e.g. "--bucket"), on the command line or through the
+	// environment, to their values. The values of secret flags are replaced by RedactedValue.
+	Flags map[string]string
+}
+
+// String returns the command path followed by the flags, sorted by name, as they could be given on the command line.
+func (inv *Invocation) String() string {
+	names := make([]string, 0, len(inv.Flags))
+	for name := range inv.Flags {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := append([]string{}, inv.Path...)
+	for _, name := range names {
+		parts = append(parts, name+"="+inv.Flags[name])
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// RunFunc runs a command, it is the function wrapped by middleware.
+type RunFunc func(ctx context.Context, inv *Invocation) error
+
+// Middleware wraps the execution of a command, which includes its hooks. It should call next to run the command,
+// unless it wants to stop it from running.
+type Middleware func(next RunFunc) RunFunc
+
+// Use adds middleware which wraps this command and all of its subcommands.
+func (c *Command) Use(middleware ...Middleware) {
+	c.Middleware = append(c.Middleware, middleware...)
+}
+
+// Use adds middleware which wraps every command, it is run before the middleware of any command.
+func (c *CLI) Use(middleware ...Middleware) {
+	c.Middleware = append(c.Middleware, middleware...)
+}
+
+// invocation returns the description of the command passed to middleware.
+func (c *Command) invocation(ctx *Context) *Invocation {
+	inv := &Invocation{
+		Path:    append([]string{}, ctx.prevCmds...),
+		Command: c,
+		Flags:   make(map[string]string),
+	}
+
+	for _, flag := range c.Flags {
+		if !flag.found() {
+			continue
+		}
+
+		value := flag.value.String()
+		if flag.secret {
+			value = RedactedValue
+		}
+
+		inv.Flags[flag.name()] = value
+	}
+
+	return inv
+}
+
+// wrap applies the middleware of the CLI and then of each command in tree order to fn, so that the middleware of the
+// CLI is the outermost.
+func (ctx *Context) wrap(fn RunFunc) RunFunc {
+	middleware := append([]Middleware{}, ctx.cli.Middleware...)
+	for _, cmd := range ctx.cmds {
+		middleware = append(middleware, cmd.Middleware...)
+	}
+
+	for idx := len(middleware) - 1; idx >= 0; idx-- {
+		fn = middleware[idx](fn)
+	}
+
+	return fn
+}
+
+// TimingMiddleware reports how long each command took to run, whether or not it succeeded.
+func TimingMiddleware(report func(inv *Invocation, elapsed time.Duration)) Middleware {
+	return func(next RunFunc) RunFunc {
+		return func(ctx context.Context, inv *Invocation) error {
+			start := time.Now()
+			defer func() { report(inv, time.Since(start)) }()
+
+			return next(ctx, inv)
+		}
+	}
+}
+
+// AuditMiddleware logs each command that is run along with its flags and result, logf can be log.Printf. The values
+// of secret flags are never logged.
+func AuditMiddleware(logf func(format string, a ...interface{})) Middleware {
+	return func(next RunFunc) RunFunc {
+		return func(ctx context.Context, inv *Invocation) error {
+			err := next(ctx, inv)
+			if err != nil {
+				logf("Ran `%s`: failed: %s", inv, err)
+			} else {
+				logf("Ran `%s`: succeeded", inv)
+			}
+
+			return err
+		}
+	}
+}
+
+// RecoverMiddleware turns a panic whilst running a command into an error which exits with ExitCodeSoftwareError,
+// rather than crashing with a stack trace.
+func RecoverMiddleware() Middleware {
+	return func(next RunFunc) RunFunc {
+		return func(ctx context.Context, inv *Invocation) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = NewExitError(ExitCodeSoftwareError, "unexpected error running `%s`: %v",
+						strings.Join(inv.Path, " "), r)
+				}
+			}()
+
+			return next(ctx, inv)
+		}
+	}
+}
+
+// TransientError marks an error as being worth retrying by RetryMiddleware.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient returns whether the error, or any error it wraps, is a TransientError.
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// RetryMiddleware runs the command up to attempts times, waiting delay between attempts, whilst it returns an error
+// for which retryable returns true. IsTransient is used if retryable is nil. Retrying stops early if the context is
+// cancelled, in which case the last error is returned.
+func RetryMiddleware(attempts int, delay time.Duration, retryable func(error) bool) Middleware {
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	return func(next RunFunc) RunFunc {
+		return func(ctx context.Context, inv *Invocation) error {
+			var err error
+			for attempt := 1; ; attempt++ {
+				if err = next(ctx, inv); err == nil || attempt >= attempts || !retryable(err) {
+					return err
+				}
+
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(delay):
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// middlewareTestCLI returns a CLI with a "bucket create" command which runs fn.
+func middlewareTestCLI(fn func() error) (*CLI, *Command) {
+	var name, password string
+
+	create := NewCommand("create", "", "", nil)
+	create.AddFlag(StringFlag(&name, "", "", "bucket", "", "", []string{}, nil, true, false))
+	create.AddFlag(GenericPasswordFlag(&password, "", "", "password", "", "", []string{}, nil, false, false))
+	create.RunE = func(context.Context, []string) error { return fn() }
+
+	bucket := NewCommand("bucket", "", "", nil)
+	bucket.AddCommand(create)
+
+	cli := NewCLI("cb", "")
+	cli.AddCommand(bucket)
+
+	return cli, bucket
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	calls := make([]string, 0)
+	record := func(name string) Middleware {
+		return func(next RunFunc) RunFunc {
+			return func(ctx context.Context, inv *Invocation) error {
+				calls = append(calls, name+":before")
+				err := next(ctx, inv)
+				calls = append(calls, name+":after")
+				return err
+			}
+		}
+	}
+
+	cli, bucket := middlewareTestCLI(func() error {
+		calls = append(calls, "run")
+		return nil
+	})
+
+	bucket.Use(record("bucket"))
+	cli.Use(record("cli-1"), record("cli-2"))
+	captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "bucket", "create", "--bucket",
+		"default"}))
+	require.Equal(t, []string{"cli-1:before", "cli-2:before", "bucket:before", "run", "bucket:after", "cli-2:after",
+		"cli-1:after"}, calls)
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	logged := make([]string, 0)
+	logf := func(format string, a ...interface{}) { logged = append(logged, fmt.Sprintf(format, a...)) }
+
+	cli, _ := middlewareTestCLI(func() error { return errors.New("bucket exists") })
+	cli.Use(AuditMiddleware(logf))
+	captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSoftwareError, cli.Execute(context.Background(), []string{"cb", "bucket", "create",
+		"--password", "secret", "--bucket", "default"}))
+	require.Equal(t, []string{"Ran `cb bucket create --bucket=default --password=*****`: failed: bucket exists"},
+		logged)
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	var (
+		path    []string
+		elapsed time.Duration
+	)
+
+	cli, _ := middlewareTestCLI(func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	cli.Use(TimingMiddleware(func(inv *Invocation, d time.Duration) { path, elapsed = inv.Path, d }))
+	captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "bucket", "create", "--bucket",
+		"default"}))
+	require.Equal(t, []string{"cb", "bucket", "create"}, path)
+	require.GreaterOrEqual(t, elapsed, 10*time.Millisecond)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	cli, _ := middlewareTestCLI(func() error { panic("nil map") })
+	cli.Use(RecoverMiddleware())
+	output := captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSoftwareError, cli.Execute(context.Background(), []string{"cb", "bucket", "create",
+		"--bucket", "default"}))
+	require.Equal(t, "Error: unexpected error running `cb bucket create`: nil map\n", output())
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	errTransient := &TransientError{Err: errors.New("temporary failure")}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		exitCode ExitCode
+	}{
+		{name: "Success", errs: []error{nil}, attempts: 1},
+		{name: "RetryThenSuccess", errs: []error{errTransient, errTransient, nil}, attempts: 3},
+		{name: "GiveUp", errs: []error{errTransient, errTransient, errTransient, nil}, attempts: 3,
+			exitCode: ExitCodeTempFailure},
+		{name: "NotTransient", errs: []error{errors.New("failed"), nil}, attempts: 1, exitCode: ExitCodeSoftwareError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			cli, _ := middlewareTestCLI(func() error {
+				attempts++
+				return test.errs[attempts-1]
+			})
+
+			cli.Use(RetryMiddleware(3, time.Millisecond, nil))
+			captureWriter(t, cli)
+
+			require.Equal(t, test.exitCode, cli.Execute(context.Background(), []string{"cb", "bucket", "create",
+				"--bucket", "default"}))
+			require.Equal(t, test.attempts, attempts)
+		})
+	}
+}
+
+func TestRetryMiddlewareCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	fn := RetryMiddleware(3, time.Hour, nil)(func(context.Context, *Invocation) error {
+		attempts++
+		return &TransientError{Err: errors.New("temporary failure")}
+	})
+
+	err := fn(ctx, &Invocation{})
+	require.True(t, IsTransient(err))
+	require.Equal(t, 1, attempts)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// The environment variables set for plugins in addition to those of the process, each flag of the root command is
+// passed as PluginEnvFlagPrefix followed by its long name in upper case with dashes replaced by underscores (e.g.
+// CBFLAG_FLAG_CLUSTER for --cluster). Secret flags are only passed when CLI.PluginSecrets is set. As flags of the root
+// command can't be given on the command line along with a subcommand, their values come from their environment
+// variables or are the defaults; a flag such as --cluster given before the plugin's name is an error.
+const (
+	PluginEnvCLI        = "CBFLAG_CLI"     // The name of the CLI
+	PluginEnvCommand    = "CBFLAG_COMMAND" // The command being run, such as "couchbase-cli bucket-stats"
+	PluginEnvFlagPrefix = "CBFLAG_FLAG_"
+)
+
+// pluginSuffix is the file extension of plugin executables.
+var pluginSuffix = func() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+
+	return ""
+}()
+
+// pluginName returns the name of the executable which implements the subcommand of the command with the given path,
+// for example "couchbase-cli-bucket-stats".
+func pluginName(path []string, subcommand string) string {
+	return strings.Join(append(append([]string{}, path...), subcommand), "-") + pluginSuffix
+}
+
+// pluginDirs returns the directories searched for plugins, PluginDirs followed by those in PATH. Empty entries in
+// PATH, which would mean the current directory, are ignored.
+func (c *CLI) pluginDirs() []string {
+	dirs := make([]string, 0, len(c.PluginDirs))
+	for _, dir := range append(append([]string{}, c.PluginDirs...), filepath.SplitList(os.Getenv("PATH"))...) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// findPlugin returns the path of the plugin which implements the subcommand of the command with the given path, it is
+// empty if plugins are not enabled or there isn't one. Subcommands which could name a file outside of the plugin
+// directories are never looked for.
+func (c *CLI) findPlugin(path []string, subcommand string) string {
+	if !c.Plugins || !isPluginSubcommand(subcommand) {
+		return ""
+	}
+
+	name := pluginName(path, subcommand)
+	for _, dir := range c.pluginDirs() {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err == nil && isExecutable(info) {
+			return filepath.Join(dir, name)
+		}
+	}
+
+	return ""
+}
+
+// isPluginSubcommand returns whether the subcommand can be implemented by a plugin, it must not be empty, "." or ".."
+// and must not contain a path separator.
+func isPluginSubcommand(subcommand string) bool {
+	return subcommand != "" && subcommand != "." && subcommand != ".." && !strings.ContainsRune(subcommand, '/') &&
+		!strings.ContainsRune(subcommand, filepath.Separator)
+}
+
+// usagePlugins returns the plugins which implement subcommands of the command with the given path, sorted by name.
+// Plugins which have the same name as one of the subcommands of the command are not included as they cannot be run.
+// The description of each plugin is the path of its executable.
+func (c *CLI) usagePlugins(path []string, cmd *Command) []*UsageCommand {
+	if !c.Plugins {
+		return nil
+	}
+
+	prefix := strings.TrimSuffix(pluginName(path, ""), pluginSuffix)
+	found := make(map[string]bool)
+	for _, sub := range cmd.Commands {
+		found[sub.Name] = true
+	}
+
+	plugins := make([]*UsageCommand, 0)
+	for _, dir := range c.pluginDirs() {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, info := range entries {
+			name := strings.TrimSuffix(info.Name(), pluginSuffix)
+			if !strings.HasPrefix(name, prefix) || name == prefix || name+pluginSuffix != info.Name() {
+				continue
+			}
+
+			// Follow symbolic links to check that the plugin can be run
+			if stat, err := os.Stat(filepath.Join(dir, info.Name())); err != nil || !isExecutable(stat) {
+				continue
+			}
+
+			name = strings.TrimPrefix(name, prefix)
+			if found[name] {
+				continue
+			}
+
+			found[name] = true
+			plugins = append(plugins, &UsageCommand{Name: name, Desc: filepath.Join(dir, info.Name())})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+func isExecutable(info fs.FileInfo) bool {
+	return info.Mode().IsRegular() && (runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0)
+}
+
+// runPlugin runs the plugin executable with the remaining arguments, it shares stdin with the process and writes to
+// the writers of the CLI. The exit code is that of the plugin. The plugin isn't killed when the context is cancelled,
+// it receives the same signals from the terminal as the CLI so it is waited for while it cleans up and exits.
+func (ctx *Context) runPlugin(plugin string, args []string) ExitCode {
+	cmd := exec.Command(plugin, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, ctx.out(), ctx.errOut()
+	cmd.Env = append(os.Environ(), ctx.pluginEnv()...)
+
+	err := cmd.Run()
+
+	// The plugin is expected to have reported why it failed itself
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return ExitCode(exitErr.ExitCode())
+	}
+
+	// A plugin interrupted by the user is treated in the same way as a RunE function which was cancelled
+	if exitErr != nil && isInterrupted(exitErr) {
+		return ExitCodeInterrupted
+	}
+
+	return ctx.handleRunError(err)
+}
+
+// isInterrupted returns whether the process was killed by SIGINT.
+func isInterrupted(err *exec.ExitError) bool {
+	status, ok := err.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGINT
+}
+
+// pluginEnv returns the environment variables which describe the command being run to a plugin, see PluginEnvCLI.
+// The flags of the root command have the value they were resolved to, secret flags are only included when
+// CLI.PluginSecrets is set.
+func (ctx *Context) pluginEnv() []string {
+	env := []string{PluginEnvCLI + "=" + ctx.cli.Name, PluginEnvCommand + "=" + strings.Join(ctx.prevCmds, " ")}
+
+	root := ctx.rootCommand()
+	for _, flag := range root.Flags {
+		// The built in flags don't describe how the command should run
+		if flag.long == "" || flag == root.helpFlag || flag == root.noColorFlag ||
+			(flag.long == "version" && ctx.cli.Version != nil) || (flag.secret && !ctx.cli.PluginSecrets) {
+			continue
+		}
+
+		if value := flag.value.String(); value != "" {
+			name := PluginEnvFlagPrefix + strings.ToUpper(strings.ReplaceAll(flag.long, "-", "_"))
+			env = append(env, name+"="+value)
+		}
+	}
+
+	return env
+}
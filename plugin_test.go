@@ -0,0 +1,227 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// pluginScript prints its arguments and the environment it was given by cbflag, exiting with the code given in the
+// PLUGIN_EXIT_CODE environment variable.
+const pluginScript = `#!/bin/sh
+echo "${0##*/} $*"
+echo "cli=$CBFLAG_CLI command=$CBFLAG_COMMAND cluster=$CBFLAG_FLAG_CLUSTER no_ssl_verify=$CBFLAG_FLAG_NO_SSL_VERIFY"
+echo "password=$CBFLAG_FLAG_PASSWORD"
+exit ${PLUGIN_EXIT_CODE:-0}
+`
+
+// writePlugins writes the plugin script to the directory under each of the given names.
+func writePlugins(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(pluginScript), 0755))
+	}
+}
+
+// pluginTestCLI returns a CLI with plugins enabled which are looked for in a temporary directory, and in another
+// temporary directory which is the only entry in PATH.
+func pluginTestCLI(t *testing.T) (*CLI, string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+
+	var (
+		cluster, password string
+		verify            bool
+	)
+
+	dir, pathDir := t.TempDir(), t.TempDir()
+	t.Setenv("PATH", pathDir)
+	t.Setenv("PLUGIN_EXIT_CODE", "")
+
+	bucket := NewCommand("bucket", "Manage buckets", "", nil)
+	bucket.AddCommand(NewCommand("create", "Creates a bucket", "", func() {}))
+
+	cli := NewCLI("cb", "")
+	cli.Plugins = true
+	cli.PluginDirs = []string{dir}
+	cli.AddFlag(StringFlag(&cluster, "localhost", "c", "cluster", "CB_PLUGIN_TEST_CLUSTER", "", []string{}, nil,
+		false, false))
+	cli.AddFlag(NoSSLVerifyFlag(&verify, []string{}, false, false))
+	cli.AddFlag(StringFlag(&password, "", "p", "password", "CB_PLUGIN_TEST_PASSWORD", "", []string{}, nil, false,
+		false).SetSecret(true))
+	cli.AddCommand(bucket)
+
+	return cli, dir, pathDir
+}
+
+func TestPlugins(t *testing.T) {
+	cli, dir, pathDir := pluginTestCLI(t)
+	output := captureWriter(t, cli)
+
+	writePlugins(t, dir, "cb-hello", "cb-bucket-stats")
+	writePlugins(t, pathDir, "cb-hello", "cb-from-path")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "PluginDir", args: []string{"hello", "--name", "my bucket"},
+			expected: "cb-hello --name my bucket\ncli=cb command=cb hello cluster=localhost no_ssl_verify=false\npassword=\n"},
+		{name: "Path", args: []string{"from-path"},
+			expected: "cb-from-path \ncli=cb command=cb from-path cluster=localhost no_ssl_verify=false\npassword=\n"},
+		{name: "Nested", args: []string{"bucket", "stats", "-h"},
+			expected: "cb-bucket-stats -h\ncli=cb command=cb bucket stats cluster=localhost no_ssl_verify=false\npassword=\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := len(output())
+			require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), append([]string{"cb"},
+				test.args...)))
+			require.Equal(t, test.expected, output()[before:])
+		})
+	}
+
+	// The root flags are resolved from the environment
+	t.Setenv("CB_PLUGIN_TEST_CLUSTER", "remote")
+	t.Setenv("PLUGIN_EXIT_CODE", "3")
+
+	before := len(output())
+	require.Equal(t, ExitCode(3), cli.Execute(context.Background(), []string{"cb", "hello"}))
+	require.Equal(t, "cb-hello \ncli=cb command=cb hello cluster=remote no_ssl_verify=false\npassword=\n",
+		output()[before:])
+
+	// Secret flags are only passed when enabled
+	t.Setenv("CB_PLUGIN_TEST_PASSWORD", "secret")
+	before = len(output())
+	require.Equal(t, ExitCode(3), cli.Execute(context.Background(), []string{"cb", "hello"}))
+	require.Equal(t, "cb-hello \ncli=cb command=cb hello cluster=remote no_ssl_verify=false\npassword=\n",
+		output()[before:])
+
+	cli.PluginSecrets = true
+	before = len(output())
+	require.Equal(t, ExitCode(3), cli.Execute(context.Background(), []string{"cb", "hello"}))
+	require.Equal(t, "cb-hello \ncli=cb command=cb hello cluster=remote no_ssl_verify=false\npassword=secret\n",
+		output()[before:])
+}
+
+func TestPluginSignals(t *testing.T) {
+	cli, dir, _ := pluginTestCLI(t)
+	output := captureWriter(t, cli)
+	writePlugins(t, dir, "cb-hello")
+
+	// The plugin isn't killed when the context is cancelled, it gets the signal from the terminal instead
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, ExitCodeSuccess, cli.Execute(ctx, []string{"cb", "hello"}))
+	require.Contains(t, output(), "cli=cb command=cb hello")
+
+	before := len(output())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cb-interrupted"), []byte("#!/bin/sh\nkill -INT $$\n"),
+		0755))
+	require.Equal(t, ExitCodeInterrupted, cli.Execute(context.Background(), []string{"cb", "interrupted"}))
+	require.Empty(t, output()[before:])
+}
+
+func TestPluginInvalidEnv(t *testing.T) {
+	cli, dir, _ := pluginTestCLI(t)
+	output := captureWriter(t, cli)
+
+	var timeout int
+	cli.AddFlag(IntFlag(&timeout, 0, "", "timeout", "CB_PLUGIN_TEST_TIMEOUT", "", []string{}, nil, false, false))
+	writePlugins(t, dir, "cb-hello")
+
+	// The root flags are parsed before the plugin is run so invalid values are reported
+	t.Setenv("CB_PLUGIN_TEST_TIMEOUT", "soon")
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "hello"}))
+	require.Contains(t, output(), "Unable to process value of CB_PLUGIN_TEST_TIMEOUT for flag: --timeout")
+	require.NotContains(t, output(), "cb-hello")
+}
+
+func TestPluginsNotFound(t *testing.T) {
+	cli, dir, _ := pluginTestCLI(t)
+	output := captureWriter(t, cli)
+
+	writePlugins(t, dir, "cb-bucket")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cb-not-executable"), []byte(pluginScript), 0644))
+
+	// Commands take precedence over plugins
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "bucket"}))
+	require.NotContains(t, output(), "cb-bucket")
+
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "not-executable"}))
+	require.Contains(t, output(), "Invalid subcommand `not-executable`")
+
+	// Flags of the root command can't be given along with a plugin, see PluginEnvFlagPrefix
+	writePlugins(t, dir, "cb-hello")
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "--cluster", "remote",
+		"hello"}))
+	require.Contains(t, output(), "Expected flag: hello")
+	require.NotContains(t, output(), "cli=cb")
+
+	// Subcommands can't name a file outside of the plugin directories
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "cb-sub"), 0755))
+	writePlugins(t, filepath.Join(dir, "cb-sub"), "hello")
+	writePlugins(t, filepath.Dir(dir), "hello")
+	for _, name := range []string{"", ".", "..", "sub/hello", "../hello", "/../../" + filepath.Base(dir) + "/cb-bucket"} {
+		require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", name}))
+		require.Contains(t, output(), "Invalid subcommand `"+name+"`")
+		require.NotContains(t, output(), "cli=cb")
+	}
+
+	cli.Plugins = false
+	writePlugins(t, dir, "cb-hello")
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "hello"}))
+	require.Contains(t, output(), "Invalid subcommand `hello`")
+}
+
+func TestPluginUsage(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	cli, dir, pathDir := pluginTestCLI(t)
+	writePlugins(t, dir, "cb-hello", "cb-bucket", "cb-bucket-stats", "other-tool")
+	writePlugins(t, pathDir, "cb-hello", "cb-aardvark")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cb-not-executable"), []byte(pluginScript), 0644))
+
+	require.Equal(t, "  bucket   Manage buckets\n\n"+
+		"Plugin Commands:\n\n"+
+		"  aardvark       "+filepath.Join(pathDir, "cb-aardvark")+"\n"+
+		"  bucket-stats   "+filepath.Join(dir, "cb-bucket-stats")+"\n"+
+		"  hello          "+filepath.Join(dir, "cb-hello")+"\n\n"+
+		"Optional Flags:\n\n"+
+		"  -c,--cluster\n"+
+		"     --no-ssl-verify          Skips SSL verification of certificates against CA\n"+
+		"  -p,--password\n"+
+		"     --no-color               Disables colored output\n\n", cli.Usage())
+
+	output := captureWriter(t, cli)
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "bucket", "--help"}))
+	require.Equal(t, "cb bucket [<command>] [<args>]\n\n"+
+		"  create   Creates a bucket\n\n"+
+		"Plugin Commands:\n\n"+
+		"  stats   "+filepath.Join(dir, "cb-bucket-stats")+"\n\n"+
+		"Optional Flags:\n\n"+
+		"  -h,--help                   Prints the help message\n\n", output())
+
+	// The plugins are only searched for when the help is asked for
+	output = captureWriter(t, cli)
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "bucket", "--unknown"}))
+	require.Contains(t, output(), "  create   Creates a bucket\n\n")
+	require.NotContains(t, output(), "Plugin Commands:")
+}
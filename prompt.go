@@ -0,0 +1,153 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/cbflag/pwd"
+	"golang.org/x/term"
+)
+
+// maxPromptAttempts is the number of times the user is asked for a value before giving up.
+const maxPromptAttempts = 3
+
+var (
+	// Provide variables so that tests can provide mock implementations.
+	promptInput      io.Reader = os.Stdin
+	promptIsTerminal           = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	promptPassword             = func(prompter *pwd.Prompter) ([]byte, error) { return prompter.GetPasswd() }
+)
+
+// prompter returns a password prompter which writes to the terminal, or to the error writer if it has been changed
+// from stderr.
+func (ctx *Context) prompter() *pwd.Prompter {
+	prompter := pwd.NewPrompter()
+	if out := ctx.errOut(); out != os.Stderr {
+		prompter.Out = out
+	}
+
+	return prompter
+}
+
+// optionHandler returns the option handler of the flag, flags which prompt for their value use the prompter. When
+// prompting isn't allowed they require a value instead.
+func (ctx *Context) optionHandler(flag *Flag) OptionHandler {
+	switch {
+	case flag.promptHandler != nil && ctx.noPrompt:
+		return DefaultOptionHandler
+	case flag.promptHandler != nil:
+		return flag.promptHandler(ctx.prompter())
+	}
+
+	return flag.optHandler
+}
+
+// promptMissing asks the user for the value of each required flag which has not been specified, it stops at the first
+// flag a valid value could not be read for.
+func (c *Command) promptMissing(ctx *Context) {
+	reader := bufio.NewReader(promptInput)
+
+	for _, flag := range c.Flags {
+		if !flag.required || flag.found() {
+			continue
+		}
+
+		if !flag.prompt(ctx, reader) {
+			return
+		}
+	}
+}
+
+// prompt reads a value for the flag from the user, giving them a limited number of attempts to provide a valid value.
+// Collections are reset before each attempt so that they don't keep the values of rejected attempts.
+func (f *Flag) prompt(ctx *Context, reader *bufio.Reader) bool {
+	f.snapshotValue()
+
+	for attempt := 0; attempt < maxPromptAttempts; attempt++ {
+		f.restoreValue()
+
+		value, err := f.readPromptValue(ctx, reader)
+		if err != nil {
+			ctx.printError("\n%s\n", &PromptError{Path: ctx.path(), Flag: f.name(), Err: err})
+			return false
+		}
+
+		if value == "" {
+			ctx.printError("%s\n", &ConstraintError{Path: ctx.path(), Arg: f.name(),
+				Err: fmt.Errorf("A value is required for %s", f.name())})
+			continue
+		}
+
+		if err := f.value.Set(value); err != nil {
+			ctx.printError("%s\n", f.invalidValueError(ctx, "", value, err))
+			continue
+		}
+
+		if err := f.validate(); err != nil {
+			ctx.printError("%s\n", f.validationError(ctx, value, err))
+			continue
+		}
+
+		f.markFound(f.name(), false, false)
+		return true
+	}
+
+	return false
+}
+
+// readPromptValue prints the prompt for the flag, see prompter, and reads the answer. Secret flags are read without
+// echoing input and flags with a fixed set of choices are presented as a numbered list.
+func (f *Flag) readPromptValue(ctx *Context, reader *bufio.Reader) (string, error) {
+	label := f.flagsHelpString()
+	if f.desc != "" {
+		label += " (" + f.desc + ")"
+	}
+
+	label = strings.TrimSpace(label)
+	prompter := ctx.prompter()
+
+	if f.secret {
+		fmt.Fprintf(prompter.Out, "%s: ", label)
+		password, err := promptPassword(prompter)
+		return string(password), err
+	}
+
+	if len(f.choices) > 0 {
+		fmt.Fprintf(prompter.Out, "%s\n", label)
+		for idx, choice := range f.choices {
+			fmt.Fprintf(prompter.Out, "  %d) %s\n", idx+1, choice)
+		}
+
+		fmt.Fprint(prompter.Out, "Choice: ")
+	} else {
+		fmt.Fprintf(prompter.Out, "%s: ", label)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	line = strings.TrimSpace(line)
+
+	// Allow choices to be selected by their number as well as their value
+	if idx, err := strconv.Atoi(line); err == nil && len(f.choices) > 0 && idx > 0 && idx <= len(f.choices) {
+		return f.choices[idx-1], nil
+	}
+
+	return line, nil
+}
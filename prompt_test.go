@@ -0,0 +1,139 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/cbflag/pwd"
+	"github.com/stretchr/testify/require"
+)
+
+// mockPrompt replaces the prompt input, terminal detection and password reader for the duration of a test.
+func mockPrompt(t *testing.T, input string, terminal bool, password string) {
+	origInput, origIsTerminal, origPassword := promptInput, promptIsTerminal, promptPassword
+
+	promptInput = strings.NewReader(input)
+	promptIsTerminal = func() bool { return terminal }
+	promptPassword = func(*pwd.Prompter) ([]byte, error) { return []byte(password), nil }
+
+	t.Cleanup(func() {
+		promptInput, promptIsTerminal, promptPassword = origInput, origIsTerminal, origPassword
+	})
+}
+
+func TestPromptMissing(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		terminal bool
+		prompt   bool
+		exitCode ExitCode
+		user     string
+		password string
+		format   string
+	}{
+		{name: "Disabled", terminal: true, exitCode: ExitCodeCLIUsageError},
+		{name: "NotTerminal", prompt: true, exitCode: ExitCodeCLIUsageError},
+		{name: "Values", input: "user\ncsv\n", terminal: true, prompt: true, user: "user", password: "pass",
+			format: "csv"},
+		{name: "ChoiceByNumber", input: "user\n1\n", terminal: true, prompt: true, user: "user", password: "pass",
+			format: "json"},
+		{name: "RetryInvalid", input: "\nuser\nxml\n3\n2\n", terminal: true, prompt: true, user: "user",
+			password: "pass", format: "csv"},
+		{name: "TooManyInvalid", input: "user\nxml\nyaml\ntoml\n", terminal: true, prompt: true,
+			exitCode: ExitCodeCLIUsageError, user: "user", password: "pass", format: "toml"},
+		{name: "EOF", input: "user", terminal: true, prompt: true, exitCode: ExitCodeCLIUsageError, user: "user",
+			password: "pass"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockPrompt(t, test.input, test.terminal, "pass")
+
+			var host, user, password, format string
+
+			command := NewCommand("", "", "", func() {})
+			command.AddFlag(StringFlag(&host, "", "c", "cluster", "", "", []string{}, nil, true, false))
+			command.AddFlag(UsernameFlag(&user, "", []string{}, true, false))
+			command.AddFlag(PasswordFlag(&password, "", []string{}, true, false))
+			command.AddFlag(EnumFlag(&format, "", []string{"json", "csv"}, "f", "format", "", "", []string{}, true,
+				false))
+
+			cli := NewCLI("", "")
+			cli.PromptMissing = test.prompt
+
+			exitCode := command.parseFlags(&Context{cli: cli, prevCmds: []string{}}, []string{"-c", "host"})
+			require.Equal(t, test.exitCode, exitCode)
+			require.Equal(t, test.user, user)
+			require.Equal(t, test.password, password)
+			require.Equal(t, test.format, format)
+		})
+	}
+}
+
+func TestPromptReadsUntilEOF(t *testing.T) {
+	var value string
+	flag := StringFlag(&value, "", "", "value", "", "", []string{}, nil, true, false)
+
+	ctx := &Context{cli: NewCLI("", ""), prevCmds: []string{}}
+
+	mockPrompt(t, "last", true, "")
+	_, err := flag.readPromptValue(ctx, bufio.NewReader(promptInput))
+	require.NoError(t, err)
+
+	mockPrompt(t, "", true, "")
+	_, err = flag.readPromptValue(ctx, bufio.NewReader(promptInput))
+	require.Equal(t, io.EOF, err)
+}
+
+func TestPromptRetryResetsCollection(t *testing.T) {
+	mockPrompt(t, "1,20\n2,3\n", true, "")
+
+	var (
+		host   string
+		values []int
+	)
+
+	command := NewCommand("", "", "", func() {})
+	command.AddFlag(StringFlag(&host, "", "c", "cluster", "", "", []string{}, nil, false, false))
+	command.AddFlag(IntArrayFlag(&values, nil, "", "values", "", "", []string{}, func(value Value) error {
+		for _, v := range *value.(*intArray) {
+			if v > 10 {
+				return fmt.Errorf("%d is greater than 10", v)
+			}
+		}
+
+		return nil
+	}, true, false).SetRepeatPolicy(RepeatAccumulate))
+
+	cli := NewCLI("", "")
+	cli.PromptMissing = true
+
+	exitCode := command.parseFlags(&Context{cli: cli, prevCmds: []string{}}, []string{"-c", "host"})
+	require.Equal(t, ExitCodeSuccess, exitCode)
+	require.Equal(t, []int{2, 3}, values)
+}
+
+func TestPrompterOutput(t *testing.T) {
+	cli := NewCLI("cb", "")
+	ctx := &Context{cli: cli, prevCmds: []string{}}
+	require.Equal(t, pwd.NewPrompter().Out, ctx.prompter().Out)
+
+	var out bytes.Buffer
+	cli.ErrWriter = &out
+	require.Equal(t, &out, ctx.prompter().Out)
+}
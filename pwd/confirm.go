@@ -0,0 +1,119 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package pwd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var ErrMismatch = errors.New("passwords do not match")
+
+// Policy is the interface used to check whether a password is acceptable.
+type Policy interface {
+	Check(password []byte) error
+}
+
+// PolicyFunc allows an ordinary function to be used as a Policy.
+type PolicyFunc func(password []byte) error
+
+func (f PolicyFunc) Check(password []byte) error {
+	return f(password)
+}
+
+// PolicyError is returned by BasicPolicy and contains each of the requirements the password failed to meet.
+type PolicyError struct {
+	Failures []string
+}
+
+func (e PolicyError) Error() string {
+	return "password must " + strings.Join(e.Failures, ", ")
+}
+
+// BasicPolicy is a Policy which checks the length of the password and the classes of characters it contains.
+type BasicPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSpecial bool
+}
+
+func (p BasicPolicy) Check(password []byte) error {
+	var length int
+	var upper, lower, digit, special bool
+	for _, r := range string(password) {
+		length++
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			special = true
+		}
+	}
+
+	failures := make([]string, 0)
+	if length < p.MinLength {
+		failures = append(failures, fmt.Sprintf("be at least %d characters long", p.MinLength))
+	}
+
+	if p.RequireUpper && !upper {
+		failures = append(failures, "contain an uppercase letter")
+	}
+
+	if p.RequireLower && !lower {
+		failures = append(failures, "contain a lowercase letter")
+	}
+
+	if p.RequireDigit && !digit {
+		failures = append(failures, "contain a digit")
+	}
+
+	if p.RequireSpecial && !special {
+		failures = append(failures, "contain a special character")
+	}
+
+	if len(failures) > 0 {
+		return PolicyError{failures}
+	}
+
+	return nil
+}
+
+// ConfirmOptions controls how a password is read by GetPasswdConfirmed.
+type ConfirmOptions struct {
+	// Prompt and ConfirmPrompt are printed before reading the password and before reading it again, they default to
+	// "Password: " and "Confirm password: ".
+	Prompt        string
+	ConfirmPrompt string
+
+	// Retries is the number of additional attempts the user is given if the passwords do not match or the password
+	// does not meet the policy.
+	Retries int
+
+	// Policy, if set, is checked against the password before asking for it to be confirmed.
+	Policy Policy
+
+	// Masked echoes asterisks whilst typing.
+	Masked bool
+}
+
+// GetPasswdConfirmed reads a password from the terminal twice and checks that both entries match. The returned byte
+// array does not include end-of-line characters. Prompter should be preferred as this writes to stdout.
+func GetPasswdConfirmed(opts ConfirmOptions) ([]byte, error) {
+	return legacyPrompter().GetPasswdConfirmed(opts)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package pwd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicPolicy(t *testing.T) {
+	policy := BasicPolicy{MinLength: 6, RequireUpper: true, RequireLower: true, RequireDigit: true,
+		RequireSpecial: true}
+
+	require.NoError(t, policy.Check([]byte("Passw0rd!")))
+	require.NoError(t, policy.Check([]byte("Ünïc0de!")))
+	require.Equal(t, PolicyError{[]string{"be at least 6 characters long", "contain an uppercase letter"}},
+		policy.Check([]byte("a1!")))
+	require.Equal(t, PolicyError{[]string{"contain a digit", "contain a special character"}},
+		policy.Check([]byte("Password")))
+	require.NoError(t, BasicPolicy{}.Check([]byte("")))
+}
+
+// TestGetPasswdConfirmed tests reading a confirmed password using a byte buffer as input to mock the underlying
+// getch() method.
+func TestGetPasswdConfirmed(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		retries  int
+		policy   Policy
+		password string
+		err      error
+	}{
+		{name: "Match", input: "abc\nabc\n", password: "abc"},
+		{name: "Mismatch", input: "abc\nabd\n", err: ErrMismatch},
+		{name: "MismatchRetry", input: "abc\nabd\nxyz\nxyz\n", retries: 1, password: "xyz"},
+		{name: "MismatchRetriesExhausted", input: "abc\nabd\nxyz\nxya\n", retries: 1, err: ErrMismatch},
+		{name: "Policy", input: "abc\nabcdef\nabcdef\n", retries: 1, policy: BasicPolicy{MinLength: 6},
+			password: "abcdef"},
+		{name: "PolicyFails", input: "abc\n", policy: BasicPolicy{MinLength: 6},
+			err: PolicyError{[]string{"be at least 6 characters long"}}},
+		{name: "PolicyFunc", input: "abc\nabc\n", password: "abc",
+			policy: PolicyFunc(func(password []byte) error { return nil })},
+		{name: "Interrupted", input: "abc\n\x03", retries: 3, err: ErrInterrupted},
+		{name: "EOF", input: "abc\n", retries: 3, err: io.EOF},
+	}
+
+	defer func() { getch = defaultGetCh }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inBuffer := bytes.NewBufferString(test.input)
+			getch = func() (byte, error) { return inBuffer.ReadByte() }
+
+			password, err := GetPasswdConfirmed(ConfirmOptions{Retries: test.retries, Policy: test.policy})
+			require.Equal(t, test.err, err)
+			require.Equal(t, test.password, string(password))
+		})
+	}
+}
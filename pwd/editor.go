@@ -0,0 +1,183 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package pwd
+
+import (
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Control characters handled by the line editor.
+const (
+	keyNull      = 0
+	keyInterrupt = 3   // Ctrl-C
+	keyEOF       = 4   // Ctrl-D
+	keyBackspace = 8   // Ctrl-H
+	keyTab       = 9   // Tab
+	keyLineFeed  = 10  // \n
+	keyReturn    = 13  // \r
+	keyKillLine  = 21  // Ctrl-U
+	keyKillWord  = 23  // Ctrl-W
+	keyEscape    = 27  // Start of an ANSI escape sequence
+	keyDelete    = 127 // Backspace on most terminals
+)
+
+// lineEditor reads a line of input a byte at a time, decoding UTF-8 and applying the editing keys supported when
+// entering a password.
+type lineEditor struct {
+	getch func() (byte, error)
+	out   io.Writer
+	mask  []byte
+
+	line []rune
+	read int
+}
+
+// readLine reads until the end of the line and returns the runes entered.
+func (e *lineEditor) readLine() ([]rune, error) {
+	for {
+		b, err := e.next()
+		if err != nil {
+			return e.line, err
+		}
+
+		switch b {
+		case keyReturn, keyLineFeed:
+			return e.line, nil
+		case keyInterrupt:
+			return e.line, ErrInterrupted
+		case keyEOF:
+			// Ctrl-D only signals the end of input on an empty line, the same as a shell
+			if len(e.line) == 0 {
+				return e.line, io.EOF
+			}
+		case keyBackspace, keyDelete:
+			e.erase(1)
+		case keyKillLine:
+			e.erase(len(e.line))
+		case keyKillWord:
+			e.erase(e.wordLength())
+		case keyEscape:
+			if err := e.skipEscapeSequence(); err != nil {
+				return e.line, err
+			}
+		default:
+			if b < utf8.RuneSelf {
+				if b != keyNull && (b == keyTab || !unicode.IsControl(rune(b))) {
+					e.insert(rune(b))
+				}
+
+				continue
+			}
+
+			r, err := e.decodeRune(b)
+			if err != nil {
+				return e.line, err
+			}
+
+			if r != utf8.RuneError && !unicode.IsControl(r) {
+				e.insert(r)
+			}
+		}
+	}
+}
+
+// next reads the next byte of input, capping the total number of bytes read. This ensures any errors that might
+// flood the console with nil or -1 bytes infinitely are capped.
+func (e *lineEditor) next() (byte, error) {
+	if e.read > maxLength {
+		return 0, ErrMaxLengthExceeded
+	}
+
+	e.read++
+	return e.getch()
+}
+
+// decodeRune reads the remaining bytes of the multi-byte UTF-8 character which starts with the given byte. Invalid
+// sequences are returned as utf8.RuneError.
+func (e *lineEditor) decodeRune(first byte) (rune, error) {
+	buf := []byte{first}
+	for !utf8.FullRune(buf) {
+		b, err := e.next()
+		if err != nil {
+			return utf8.RuneError, err
+		}
+
+		buf = append(buf, b)
+	}
+
+	r, _ := utf8.DecodeRune(buf)
+	return r, nil
+}
+
+// skipEscapeSequence consumes an ANSI escape sequence, such as those sent by the arrow keys, so that it does not end
+// up in the line. Cursor movement is not supported whilst entering a password so the sequences are ignored.
+func (e *lineEditor) skipEscapeSequence() error {
+	b, err := e.next()
+	if err != nil {
+		return err
+	}
+
+	switch b {
+	case '[':
+		// Control Sequence Introducer: parameter and intermediate bytes followed by a final byte in 0x40-0x7E
+		for {
+			if b, err = e.next(); err != nil {
+				return err
+			}
+
+			if b >= 0x40 && b <= 0x7e {
+				return nil
+			}
+		}
+	case 'O':
+		// Single Shift Three, used by some terminals for the arrow and function keys
+		_, err = e.next()
+		return err
+	}
+
+	// Alt+<key> sends escape followed by the key, which is dropped
+	return nil
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line, r)
+	e.out.Write(e.mask) //nolint:errcheck
+}
+
+// erase removes up to n runes from the end of the line.
+func (e *lineEditor) erase(n int) {
+	if n > len(e.line) {
+		n = len(e.line)
+	}
+
+	e.line = e.line[:len(e.line)-n]
+	if len(e.mask) > 0 {
+		for i := 0; i < n; i++ {
+			e.out.Write([]byte("\b \b")) //nolint:errcheck
+		}
+	}
+}
+
+// wordLength returns the number of runes deleted by Ctrl-W, trailing spaces followed by the last word.
+func (e *lineEditor) wordLength() int {
+	i := len(e.line)
+	for i > 0 && unicode.IsSpace(e.line[i-1]) {
+		i--
+	}
+
+	for i > 0 && !unicode.IsSpace(e.line[i-1]) {
+		i--
+	}
+
+	return len(e.line) - i
+}
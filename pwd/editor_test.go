@@ -0,0 +1,62 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package pwd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		password string
+		masked   string
+		err      error
+	}{
+		{name: "MultiByte", input: "pä€𝄞\n", password: "pä€𝄞", masked: "****"},
+		{name: "BackspaceMultiByte", input: "a€\x7fb\n", password: "ab", masked: "**\b \b*"},
+		{name: "InvalidUTF8", input: "a\xffb\n", password: "ab", masked: "**"},
+		{name: "ArrowKeys", input: "a\x1b[A\x1b[Db\x1bOCc\n", password: "abc", masked: "***"},
+		{name: "DeleteKey", input: "ab\x1b[3~c\n", password: "abc", masked: "***"},
+		{name: "AltKey", input: "a\x1bxb\n", password: "ab", masked: "**"},
+		{name: "KillLine", input: "abc\x15de\n", password: "de", masked: "***\b \b\b \b\b \b**"},
+		{name: "KillWord", input: "ab cd  \x17e\n", password: "ab e", masked: "*******" +
+			strings.Repeat("\b \b", 4) + "*"},
+		{name: "Tab", input: "a\tb\n", password: "a\tb", masked: "***"},
+		{name: "ControlIgnored", input: "a\x01\x02b\n", password: "ab", masked: "**"},
+		{name: "EOFEmpty", input: "\x04", password: "", err: io.EOF},
+		{name: "EOFNotEmpty", input: "ab\x04c\n", password: "abc", masked: "***"},
+		{name: "Interrupt", input: "ab\x03", password: "ab", masked: "**", err: ErrInterrupted},
+		{name: "EndOfInput", input: "ab", password: "ab", masked: "**", err: io.EOF},
+		{name: "EndOfInputInRune", input: "a\xe2\x82", password: "a", masked: "*", err: io.EOF},
+		{name: "EndOfInputInEscape", input: "a\x1b[1", password: "a", masked: "*", err: io.EOF},
+		{name: "TooLong", input: strings.Repeat("a", maxLength+10), password: strings.Repeat("a", maxLength+1),
+			masked: strings.Repeat("*", maxLength+1), err: ErrMaxLengthExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			prompter := &Prompter{In: strings.NewReader(test.input), Out: &out}
+
+			password, err := prompter.GetPasswdMasked()
+			require.Equal(t, test.err, err)
+			require.Equal(t, test.password, string(password))
+			require.Equal(t, test.masked, out.String())
+		})
+	}
+}
@@ -39,68 +39,34 @@ var (
 	getch = defaultGetCh
 )
 
+// legacyPrompter returns a Prompter which reads from stdin and writes to stdout, this is the behaviour of the
+// package level functions which predate Prompter.
+func legacyPrompter() *Prompter {
+	return &Prompter{
+		In:         os.Stdin,
+		Out:        os.Stdout,
+		IsTerminal: func() bool { return term.IsTerminal(int(os.Stdin.Fd())) },
+		readByte:   getch,
+	}
+}
+
 // getPasswd returns the input read from terminal.
 // If masked is true, typing will be matched by asterisks on the screen.
 // Otherwise, typing will echo nothing.
 func getPasswd(masked bool) ([]byte, error) {
-	var err error
-	var pass, bs, mask []byte
-	if masked {
-		bs = []byte("\b \b")
-		mask = []byte("*")
-	}
-
-	if term.IsTerminal(int(os.Stdin.Fd())) {
-		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-		if err != nil {
-			return pass, err
-		}
-
-		defer func() {
-			term.Restore(int(os.Stdin.Fd()), oldState) //nolint:errcheck
-			fmt.Print("\n")
-		}()
-	}
-
-	// Track total bytes read, not just bytes in the password.  This ensures any
-	// errors that might flood the console with nil or -1 bytes infinitely are
-	// capped.
-	var counter int
-	for counter = 0; counter <= maxLength; counter++ {
-		if v, e := getch(); e != nil {
-			err = e
-			break
-		} else if v == 127 || v == 8 {
-			if l := len(pass); l > 0 {
-				pass = pass[:l-1]
-				fmt.Print(string(bs))
-			}
-		} else if v == 13 || v == 10 {
-			break
-		} else if v == 3 {
-			err = ErrInterrupted
-			break
-		} else if v != 0 {
-			pass = append(pass, v)
-			fmt.Print(string(mask))
-		}
-	}
-
-	if counter > maxLength {
-		err = ErrMaxLengthExceeded
-	}
-
-	return pass, err
+	return legacyPrompter().readPasswd(masked)
 }
 
 // GetPasswd returns the password read from the terminal without echoing input.
-// The returned byte array does not include end-of-line characters.
+// The returned byte array does not include end-of-line characters. Prompter should be preferred as this writes to
+// stdout.
 func GetPasswd() ([]byte, error) {
 	return getPasswd(false)
 }
 
 // GetPasswdMasked returns the password read from the terminal, echoing asterisks.
-// The returned byte array does not include end-of-line characters.
+// The returned byte array does not include end-of-line characters. Prompter should be preferred as this writes to
+// stdout.
 func GetPasswdMasked() ([]byte, error) {
 	return getPasswd(true)
 }
@@ -0,0 +1,174 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package pwd
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	ttyOnce sync.Once
+	tty     *os.File
+)
+
+// defaultOutput returns the controlling terminal if it can be opened, so that prompts are still seen by the user
+// when stdout and stderr are redirected; otherwise stderr.
+func defaultOutput() io.Writer {
+	ttyOnce.Do(func() {
+		tty, _ = os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	})
+
+	if tty != nil {
+		return tty
+	}
+
+	return os.Stderr
+}
+
+// fder is implemented by readers that have a file descriptor, such as *os.File.
+type fder interface {
+	Fd() uintptr
+}
+
+// Prompter reads passwords from a terminal, the input, output and terminal detection can all be replaced which allows
+// prompts to be kept off stdout and makes testing straightforward.
+type Prompter struct {
+	// In is where input is read from, it is read a byte at a time so that no input beyond the password is consumed.
+	In io.Reader
+
+	// Out is where prompts and masking characters are written.
+	Out io.Writer
+
+	// IsTerminal reports whether In is a terminal, if it is then it is put into raw mode whilst reading.
+	IsTerminal func() bool
+
+	// readByte, if set, is used to read input instead of In.
+	readByte func() (byte, error)
+}
+
+// NewPrompter returns a Prompter which reads from stdin and writes to the controlling terminal, or stderr if there
+// isn't one.
+func NewPrompter() *Prompter {
+	return &Prompter{
+		In:         os.Stdin,
+		Out:        defaultOutput(),
+		IsTerminal: func() bool { return term.IsTerminal(int(os.Stdin.Fd())) },
+	}
+}
+
+// GetPasswd returns the password read from the terminal without echoing input.
+// The returned byte array does not include end-of-line characters.
+func (p *Prompter) GetPasswd() ([]byte, error) {
+	return p.readPasswd(false)
+}
+
+// GetPasswdMasked returns the password read from the terminal, echoing asterisks.
+// The returned byte array does not include end-of-line characters.
+func (p *Prompter) GetPasswdMasked() ([]byte, error) {
+	return p.readPasswd(true)
+}
+
+// Prompt writes the prompt to the output and then reads a password without echoing input.
+func (p *Prompter) Prompt(prompt string) ([]byte, error) {
+	fmt.Fprint(p.Out, prompt)
+	return p.readPasswd(false)
+}
+
+// GetPasswdConfirmed reads a password from the terminal twice and checks that both entries match. The returned byte
+// array does not include end-of-line characters.
+func (p *Prompter) GetPasswdConfirmed(opts ConfirmOptions) ([]byte, error) {
+	if opts.Prompt == "" {
+		opts.Prompt = "Password: "
+	}
+
+	if opts.ConfirmPrompt == "" {
+		opts.ConfirmPrompt = "Confirm password: "
+	}
+
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			fmt.Fprintf(p.Out, "%s, please try again\n", err.Error())
+		}
+
+		var password, confirm []byte
+		fmt.Fprint(p.Out, opts.Prompt)
+		if password, err = p.readPasswd(opts.Masked); err != nil {
+			return nil, err
+		}
+
+		if opts.Policy != nil {
+			if err = opts.Policy.Check(password); err != nil {
+				continue
+			}
+		}
+
+		fmt.Fprint(p.Out, opts.ConfirmPrompt)
+		if confirm, err = p.readPasswd(opts.Masked); err != nil {
+			return nil, err
+		}
+
+		if subtle.ConstantTimeCompare(password, confirm) != 1 {
+			err = ErrMismatch
+			continue
+		}
+
+		return password, nil
+	}
+
+	return nil, err
+}
+
+func (p *Prompter) getch() (byte, error) {
+	if p.readByte != nil {
+		return p.readByte()
+	}
+
+	buf := make([]byte, 1)
+	if n, err := p.In.Read(buf); n == 0 || err != nil {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	return buf[0], nil
+}
+
+// readPasswd returns the input read from terminal.
+// If masked is true, typing will be matched by asterisks on the screen.
+// Otherwise, typing will echo nothing.
+func (p *Prompter) readPasswd(masked bool) ([]byte, error) {
+	editor := &lineEditor{getch: p.getch, out: p.Out}
+	if masked {
+		editor.mask = []byte("*")
+	}
+
+	if in, ok := p.In.(fder); ok && p.IsTerminal != nil && p.IsTerminal() {
+		oldState, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			term.Restore(int(in.Fd()), oldState) //nolint:errcheck
+			fmt.Fprint(p.Out, "\n")
+		}()
+	}
+
+	line, err := editor.readLine()
+	return []byte(string(line)), err
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package pwd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrompter tests that a Prompter reads from its input and writes prompts and masking characters to its output
+// rather than stdin/stdout.
+func TestPrompter(t *testing.T) {
+	var out bytes.Buffer
+	prompter := &Prompter{In: strings.NewReader("abc\ndef\x7f\x7fg\n"), Out: &out}
+
+	password, err := prompter.Prompt("Password: ")
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(password))
+
+	password, err = prompter.GetPasswdMasked()
+	require.NoError(t, err)
+	require.Equal(t, "dg", string(password))
+
+	require.Equal(t, "Password: ***\b \b\b \b*", out.String())
+}
+
+func TestPrompterConfirmed(t *testing.T) {
+	var out bytes.Buffer
+	prompter := &Prompter{In: strings.NewReader("abc\nabd\nxyz\nxyz\n"), Out: &out}
+
+	password, err := prompter.GetPasswdConfirmed(ConfirmOptions{Prompt: "New: ", ConfirmPrompt: "Again: ", Retries: 1})
+	require.NoError(t, err)
+	require.Equal(t, "xyz", string(password))
+	require.Equal(t, "New: Again: passwords do not match, please try again\nNew: Again: ", out.String())
+}
+
+// TestPrompterNotTerminal tests that a Prompter doesn't attempt to put a reader that isn't a terminal into raw mode.
+func TestPrompterNotTerminal(t *testing.T) {
+	var out bytes.Buffer
+	prompter := &Prompter{In: strings.NewReader("abc\n"), Out: &out, IsTerminal: func() bool { return true }}
+
+	password, err := prompter.GetPasswd()
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(password))
+	require.Empty(t, out.String())
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+// RepeatPolicy controls what happens when a flag is given more than once on the command line. Deprecated names of a
+// flag are aliases for it, so "--bucket-name a --bucket b" repeats the flag. A value from an environment variable is
+// never counted as a repeat, the command line always replaces it.
+type RepeatPolicy uint8
+
+const (
+	// RepeatDefault uses the policy of the CLI for a flag, and RepeatError for the CLI.
+	RepeatDefault RepeatPolicy = iota
+	// RepeatError rejects the command line with a DuplicateFlagError.
+	RepeatError
+	// RepeatLastWins uses the value given last, earlier values are discarded.
+	RepeatLastWins
+	// RepeatFirstWins uses the value given first, later values are ignored without being parsed or validated.
+	RepeatFirstWins
+	// RepeatAccumulate adds each value to flags which hold a collection, such as IntArrayFlag and StringMapFlag.
+	// Other flags use RepeatLastWins.
+	RepeatAccumulate
+)
+
+// SetRepeatPolicy sets what happens when the flag is given more than once, overriding the policy of the CLI.
+func (f *Flag) SetRepeatPolicy(policy RepeatPolicy) *Flag {
+	f.repeat = policy
+	return f
+}
+
+// RepeatPolicy returns the repeat policy set on the flag, RepeatDefault if it uses the policy of the CLI.
+func (f *Flag) RepeatPolicy() RepeatPolicy {
+	return f.repeat
+}
+
+// repeatPolicy returns the policy which applies to the flag when parsed by the CLI.
+func (f *Flag) repeatPolicy(cli *CLI) RepeatPolicy {
+	policy := f.repeat
+	if policy == RepeatDefault {
+		policy = cli.RepeatPolicy
+	}
+
+	if policy == RepeatDefault {
+		return RepeatError
+	}
+
+	if policy == RepeatAccumulate && !isCollection(f.value) {
+		return RepeatLastWins
+	}
+
+	return policy
+}
+
+// snapshotValue records the current value of the flag so that it can be restored by restoreValue, it is called before
+// any values are parsed.
+func (f *Flag) snapshotValue() {
+	f.restore = nil
+	if value, ok := f.value.(snapshotter); ok && isCollection(f.value) {
+		f.restore = value.snapshot()
+	}
+}
+
+// restoreValue discards any values added to the flag since snapshotValue was called. Values which are not collections
+// are replaced whenever they are set so do not need restoring.
+func (f *Flag) restoreValue() {
+	if f.restore != nil {
+		f.restore()
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepeatPolicy(t *testing.T) {
+	type result struct {
+		name  string
+		ports []int
+		force bool
+	}
+
+	tests := []struct {
+		name       string
+		cliPolicy  RepeatPolicy
+		flagPolicy RepeatPolicy
+		env        string
+		args       []string
+		exitCode   ExitCode
+		expected   result
+	}{
+		{name: "ErrorByDefault", args: []string{"--name", "a", "--name", "b"}, exitCode: ExitCodeCLIUsageError},
+		{name: "ErrorDeprecatedAlias", cliPolicy: RepeatError, args: []string{"--bucket", "a", "-n", "b"},
+			exitCode: ExitCodeCLIUsageError},
+		{
+			name:      "LastWins",
+			cliPolicy: RepeatLastWins,
+			args:      []string{"--name", "a", "--port", "1", "-n", "b", "--port", "2,3", "--force", "--force"},
+			expected:  result{name: "b", ports: []int{2, 3}, force: true},
+		},
+		{
+			name:      "LastWinsDeprecatedAlias",
+			cliPolicy: RepeatLastWins,
+			args:      []string{"--bucket", "a", "--name", "b"},
+			expected:  result{name: "b"},
+		},
+		{
+			name:      "FirstWins",
+			cliPolicy: RepeatFirstWins,
+			args:      []string{"--name", "a", "--port", "1", "--name", "b", "--port", "not-a-port"},
+			expected:  result{name: "a", ports: []int{1}},
+		},
+		{
+			name:      "Accumulate",
+			cliPolicy: RepeatAccumulate,
+			args:      []string{"--name", "a", "--port", "1", "--port", "2,3", "--name=b"},
+			expected:  result{name: "b", ports: []int{1, 2, 3}},
+		},
+		{
+			name:       "FlagOverridesCLI",
+			cliPolicy:  RepeatLastWins,
+			flagPolicy: RepeatAccumulate,
+			args:       []string{"--name", "a", "--port", "1", "--port", "2", "--name", "b"},
+			expected:   result{name: "b", ports: []int{1, 2}},
+		},
+		{
+			name:     "EnvReplaced",
+			env:      "5,6",
+			args:     []string{"--name", "a", "--port", "1"},
+			expected: result{name: "a", ports: []int{1}},
+		},
+		{
+			name:      "EnvReplacedAccumulate",
+			cliPolicy: RepeatAccumulate,
+			env:       "5,6",
+			args:      []string{"--name", "a", "--port", "1", "--port", "2"},
+			expected:  result{name: "a", ports: []int{1, 2}},
+		},
+		{
+			name:     "EnvOnly",
+			env:      "5,6",
+			args:     []string{"--name", "a"},
+			expected: result{name: "a", ports: []int{5, 6}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CB_PORTS", test.env)
+
+			var actual result
+			cli := NewCLI("cb", "")
+			cli.RepeatPolicy = test.cliPolicy
+			cli.Run = func() {}
+			cli.AddFlag(StringFlag(&actual.name, "", "n", "name", "", "", []string{"bucket"}, nil, true, false))
+			cli.AddFlag(IntArrayFlag(&actual.ports, nil, "", "port", "CB_PORTS", "", []string{}, nil, false,
+				false).SetRepeatPolicy(test.flagPolicy))
+			cli.AddFlag(BoolFlag(&actual.force, false, "", "force", "", "", []string{}, false))
+			captureWriter(t, cli)
+
+			require.Equal(t, test.exitCode, cli.Execute(context.Background(), append([]string{"cb"}, test.args...)))
+			if test.exitCode == ExitCodeSuccess {
+				require.Equal(t, test.expected, actual)
+			}
+		})
+	}
+}
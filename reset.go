@@ -0,0 +1,114 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+// Reset returns the flag to the state it was in before any arguments were parsed, its value is set back to the default
+// and it is no longer marked as found.
+func (f *Flag) Reset() {
+	if f.reset != nil {
+		f.reset()
+	}
+
+	f.foundLong, f.foundShort, f.foundEnv, f.foundDepr = false, false, false, false
+	f.restore, f.undo = nil, nil
+}
+
+// Set sets the value of the flag in the same way as a value given on the command line, the value is used as the
+// default by the next Execute even if it's the same as the value left by the previous one. See beginParse. It must not
+// be called while the CLI is being executed from another goroutine.
+func (f *Flag) Set(value string) error {
+	if err := f.value.Set(value); err != nil {
+		return err
+	}
+
+	f.undo = nil
+
+	return nil
+}
+
+// Reset returns the command, its flags and all of its subcommands to the state they were in before any arguments were
+// parsed.
+func (c *Command) Reset() {
+	c.help, c.showVersion = false, false
+
+	for _, flag := range c.Flags {
+		flag.Reset()
+	}
+
+	for _, cmd := range c.Commands {
+		cmd.Reset()
+	}
+}
+
+// Reset returns all of the commands and flags of the CLI to the state they were in before any arguments were parsed,
+// setting the values of the flags back to the defaults they were created with. Execute and Parse don't need it to be
+// called between them, see beginParse.
+func (c *CLI) Reset() {
+	for _, flag := range c.Flags {
+		flag.Reset()
+	}
+
+	for _, cmd := range c.Commands {
+		cmd.Reset()
+	}
+}
+
+// beginParse prepares the flag to be parsed again. The value set by the previous parse is undone, unless it has been
+// changed since, so that a value set before Execute is used as the default rather than the one the flag was created
+// with. Changes made using Set are always kept, changes made to the variable directly are only noticed if the value
+// differs from the one left by the previous parse.
+func (f *Flag) beginParse() {
+	if f.undo != nil && f.value.String() == f.parsed {
+		f.undo()
+	}
+
+	f.foundLong, f.foundShort, f.foundEnv, f.foundDepr = false, false, false, false
+	f.restore, f.undo = nil, nil
+
+	if value, ok := f.value.(snapshotter); ok {
+		f.undo = value.snapshot()
+	}
+}
+
+// endParse records the value left by parsing the flag, see beginParse.
+func (f *Flag) endParse() {
+	f.parsed = f.value.String()
+}
+
+// parseRoot parses the arguments with the command as the root, undoing anything set by the previous parse first.
+func (c *Command) parseRoot(ctx *Context, args []string) ExitCode {
+	c.beginParse()
+	defer c.endParse()
+
+	return c.parse(ctx, args)
+}
+
+func (c *Command) beginParse() {
+	c.help, c.showVersion = false, false
+
+	for _, flag := range c.Flags {
+		flag.beginParse()
+	}
+
+	for _, cmd := range c.Commands {
+		cmd.beginParse()
+	}
+}
+
+func (c *Command) endParse() {
+	for _, flag := range c.Flags {
+		flag.endParse()
+	}
+
+	for _, cmd := range c.Commands {
+		cmd.endParse()
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteTwice(t *testing.T) {
+	var (
+		name    string
+		ports   []int
+		mapping map[string]string
+		force   bool
+	)
+
+	create := NewCommand("create", "", "", func() {})
+	create.AddFlag(StringFlag(&name, "default", "", "name", "", "", []string{}, nil, false, false))
+	create.AddFlag(IntArrayFlag(&ports, nil, "", "port", "", "", []string{}, nil, false, false))
+	create.AddFlag(StringMapFlag(&mapping, map[string]string{}, "", "map", "", "", []string{}, nil, false, false))
+	create.AddFlag(BoolFlag(&force, false, "", "force", "", "", []string{}, false))
+
+	cli := NewCLI("cb", "")
+	cli.AddCommand(create)
+	captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "create", "--name", "a",
+		"--port", "1,2", "--map", "a=b", "--force"}))
+	require.Equal(t, "a", name)
+	require.Equal(t, []int{1, 2}, ports)
+	require.Equal(t, map[string]string{"a": "b"}, mapping)
+	require.True(t, force)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "create", "--port", "3",
+		"--map", "c=d"}))
+	require.Equal(t, "default", name)
+	require.Equal(t, []int{3}, ports)
+	require.Equal(t, map[string]string{"c": "d"}, mapping)
+	require.False(t, force)
+
+	// The help flag should not stay set either
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "create", "--help"}))
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "create", "--name", "b"}))
+	require.Equal(t, "b", name)
+}
+
+func TestExecuteKeepsCallerValues(t *testing.T) {
+	var name, bucketType string
+
+	cli := NewCLI("cb", "")
+	cli.AddFlag(StringFlag(&name, "default", "", "name", "", "", []string{}, nil, false, false))
+	cli.AddFlag(StringFlag(&bucketType, "couchbase", "", "type", "", "", []string{}, nil, false, false))
+	cli.Run = func() {}
+	captureWriter(t, cli)
+
+	// Values set before Execute are the defaults
+	name = "preset"
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--type", "ephemeral"}))
+	require.Equal(t, "preset", name)
+	require.Equal(t, "ephemeral", bucketType)
+
+	// Values set by the previous Execute are undone, unless they have been changed since
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--name", "a"}))
+	require.Equal(t, "a", name)
+	require.Equal(t, "couchbase", bucketType)
+
+	name = "changed"
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--type", "memcached"}))
+	require.Equal(t, "changed", name)
+	require.Equal(t, "memcached", bucketType)
+
+	cli.Reset()
+	require.Equal(t, "default", name)
+	require.Equal(t, "couchbase", bucketType)
+}
+
+func TestExecuteKeepsValuesSetUsingSet(t *testing.T) {
+	var name string
+
+	cli := NewCLI("cb", "")
+	flag := StringFlag(&name, "default", "", "name", "", "", []string{}, nil, false, false)
+	cli.AddFlag(flag)
+	cli.Run = func() {}
+	captureWriter(t, cli)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--name", "a"}))
+	require.Equal(t, "a", name)
+
+	// The value is kept even though it's the same as the one set by the previous Execute
+	require.NoError(t, flag.Set("a"))
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb"}))
+	require.Equal(t, "a", name)
+
+	// Values set by Execute are still undone
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--name", "b"}))
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb"}))
+	require.Equal(t, "a", name)
+}
+
+func TestReset(t *testing.T) {
+	var ports []int
+
+	flag := IntArrayFlag(&ports, []int{8091}, "", "port", "", "", []string{}, nil, false, false)
+	require.NoError(t, flag.value.Set("1"))
+	flag.markFound("--port", false, false)
+
+	flag.Reset()
+	require.Equal(t, []int{8091}, ports)
+	require.False(t, flag.found())
+}
+
+func TestExecuteConcurrently(t *testing.T) {
+	var name string
+
+	cli := NewCLI("cb", "")
+	cli.Writer, cli.ErrWriter = ioutil.Discard, ioutil.Discard
+	cli.AddFlag(StringFlag(&name, "", "", "name", "", "", []string{}, nil, true, false))
+
+	names := make(chan string, 20)
+	cli.Run = func() { names <- name }
+
+	var wg sync.WaitGroup
+	for i := 0; i < cap(names); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "--name",
+				string(rune('a' + i))}))
+		}(i)
+	}
+
+	wg.Wait()
+	close(names)
+
+	seen := make(map[string]bool)
+	for name := range names {
+		seen[name] = true
+	}
+
+	require.Len(t, seen, cap(names))
+}
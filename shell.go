@@ -0,0 +1,478 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// maxShellHistory is the number of lines kept in the history of the shell.
+const maxShellHistory = 1000
+
+var (
+	// Provide variables so that tests can provide mock implementations.
+	shellInput      io.Reader = os.Stdin
+	shellIsTerminal           = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	shellMakeRaw              = func() (func(), error) {
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return nil, err
+		}
+
+		return func() { term.Restore(int(os.Stdin.Fd()), state) }, nil //nolint:errcheck
+	}
+)
+
+// ShellConfig configures the interactive shell added by setting CLI.Shell. The shell reads lines, splits them into
+// arguments using shell-like quoting and runs them as if they had been given to the CLI, "exit" or "quit" leaves the
+// shell. When stdin is a terminal the lines can be edited, previous lines recalled with the up and down keys and the
+// commands and flags completed with tab.
+type ShellConfig struct {
+	// Prompt is printed before each line is read, by default it is the name of the CLI followed by "> ".
+	Prompt string
+
+	// HistoryFile is where the lines entered are kept so that they can be recalled in later sessions, by default this
+	// is ".<name>_history" in the home directory of the user. The values of secret flags are never written to it.
+	HistoryFile string
+
+	// PersistentFlags are the long names of the flags, such as "cluster", "username" and "password", which are
+	// remembered once given. They are added to the following lines which run a command that has the flag, unless the
+	// line gives the flag itself.
+	PersistentFlags []string
+}
+
+// shell is the state of a running shell.
+type shell struct {
+	ctx    *Context
+	config *ShellConfig
+	root   *Command
+
+	// persistent is the last value given for each of the persistent flags, by long name.
+	persistent map[string]flagArg
+
+	// editor is nil if stdin is not a terminal, in which case the history is not used.
+	editor      *lineEditor
+	historyFile string
+	historyErr  bool
+}
+
+// newShellCommand returns the built in shell command.
+func newShellCommand() *Command {
+	cmd := NewCommand("shell", "Starts an interactive shell which runs commands", "", nil)
+	cmd.builtin = cmd.runShell
+	return cmd
+}
+
+// runShell runs lines read from stdin until the end of the input, "exit" or the context being cancelled. The exit code
+// is that of the last line run.
+func (c *Command) runShell(ctx *Context, args []string) ExitCode {
+	ctx.prevCmds = append(ctx.prevCmds, c.Name)
+	c.initialize()
+
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" {
+			fmt.Fprint(ctx.out(), c.fullUsage(ctx))
+			return ExitCodeSuccess
+		}
+
+		var err error = &UnknownFlagError{Path: ctx.path(), Flag: arg}
+		if !strings.HasPrefix(arg, "-") {
+			err = &ConstraintError{Path: ctx.path(), Arg: arg, Err: fmt.Errorf("Expected flag: %s", arg)}
+		}
+
+		// Unexpected argument, exit with a non-zero exit code
+		return c.parseError(ctx, err)
+	}
+
+	// The shell reads from the terminal of the process, which isolated executions must not do
+	if ctx.noPrompt {
+		return ctx.reportError(&ConstraintError{Path: ctx.path(),
+			Err: errors.New("The shell can't be run by an isolated execution")})
+	}
+
+	s := &shell{
+		ctx:        ctx,
+		config:     ctx.cli.Shell,
+		root:       ctx.rootCommand(),
+		persistent: make(map[string]flagArg),
+	}
+
+	if s.config == nil {
+		s.config = &ShellConfig{}
+	}
+
+	return s.run(c.Name)
+}
+
+func (s *shell) run(name string) ExitCode {
+	reader := bufio.NewReader(shellInput)
+	if shellIsTerminal() {
+		s.historyFile = s.config.HistoryFile
+		if s.historyFile == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				s.historyFile = filepath.Join(home, "."+s.ctx.cli.Name+"_history")
+			}
+		}
+
+		s.editor = &lineEditor{
+			in:       reader,
+			out:      s.ctx.errOut(),
+			prompt:   s.prompt(),
+			history:  s.loadHistory(),
+			complete: s.complete,
+		}
+	}
+
+	exitCode := ExitCodeSuccess
+	for s.ctx.context().Err() == nil {
+		line, err := s.readLine(reader)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			s.ctx.printError("Error: unable to read command: %s\n", err.Error())
+			return ExitCodeIOError
+		}
+
+		args, err := splitCommandLine(line)
+		if err != nil {
+			s.ctx.printError("Error: %s\n", err.Error())
+			exitCode = ExitCodeCLIUsageError
+			continue
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		s.addHistory(line, args)
+
+		switch args[0] {
+		case "exit", "quit":
+			return exitCode
+		case name:
+			s.ctx.printError("Error: the shell is already running\n")
+			exitCode = ExitCodeCLIUsageError
+		default:
+			exitCode = s.runLine(args)
+		}
+	}
+
+	return exitCode
+}
+
+func (s *shell) prompt() string {
+	if s.config.Prompt != "" {
+		return s.config.Prompt
+	}
+
+	return s.ctx.cli.Name + "> "
+}
+
+// readLine reads the next line, using the line editor if stdin is a terminal. The terminal is only in raw mode whilst
+// the line is being read so that commands, and any prompts they show, work as they usually would.
+func (s *shell) readLine(reader *bufio.Reader) (string, error) {
+	if s.editor == nil {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+
+		return line, err
+	}
+
+	restore, err := shellMakeRaw()
+	if err != nil {
+		return "", err
+	}
+
+	defer restore()
+	return s.editor.readLine()
+}
+
+// flagArg is a flag, as it would be given on the command line, which is added to the arguments of the commands that
+// have it. See withFlags.
+type flagArg struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// runLine runs the arguments from a line in the same way as Execute, along with any persistent flags.
+func (s *shell) runLine(args []string) ExitCode {
+	persistent := make([]flagArg, 0, len(s.persistent))
+	for _, name := range s.config.PersistentFlags {
+		if flag, ok := s.persistent[name]; ok {
+			persistent = append(persistent, flag)
+		}
+	}
+
+	ctx := s.ctx.lineContext()
+	exitCode := ctx.root.parseRoot(ctx, ctx.root.withFlags(args, persistent))
+
+	for _, cmd := range ctx.cmds {
+		for _, name := range s.config.PersistentFlags {
+			if flag, _ := cmd.findFlagByName("--" + name); flag != nil && flag.foundNonEnv() {
+				s.persistent[name] = flagArg{name: "--" + name, value: flag.value.String(), hasValue: !flag.isFlag}
+			}
+		}
+	}
+
+	return exitCode
+}
+
+// lineContext returns the context to parse a line read by the shell or batch command, the line should be parsed using
+// parseRoot so that nothing is left over from the previous line.
+func (ctx *Context) lineContext() *Context {
+	root := ctx.rootCommand()
+
+	lineCtx := &Context{
+		cli:      ctx.cli,
+		prevCmds: make([]string, 0),
+		style:    ctx.style,
+		errStyle: ctx.errStyle,
+		runCtx:   ctx.runCtx,
+		root:     root,
+		stdout:   ctx.stdout,
+		stderr:   ctx.stderr,
+		noPrompt: ctx.noPrompt,
+	}
+
+	// The result of an isolated execution should describe the line being run rather than the whole execution
+	if result, ok := ResultFromContext(lineCtx.context()); ok {
+		result.ctx = lineCtx
+	}
+
+	return lineCtx
+}
+
+// findCommand returns the command which the arguments would run, commands always come before flags so it is found by
+// following the leading arguments.
+func (c *Command) findCommand(args []string) *Command {
+	cmd := c
+	for _, arg := range args {
+		var next *Command
+		for _, sub := range cmd.Commands {
+			if sub.Name == arg {
+				next = sub
+				break
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		cmd = next
+	}
+
+	return cmd
+}
+
+// withFlags returns the arguments with the given flags added to the end, only the flags which the command being run
+// has, and which are not given in the arguments, are added.
+func (c *Command) withFlags(args []string, flags []flagArg) []string {
+	cmd := c.findCommand(args)
+	given := make(map[*Flag]bool)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		if idx := strings.Index(arg, "="); idx != -1 && strings.HasPrefix(arg, "--") {
+			arg = arg[:idx]
+		}
+
+		if flag, _ := cmd.findFlagByName(arg); flag != nil {
+			given[flag] = true
+		}
+	}
+
+	withFlags := append(make([]string, 0, len(args)+2*len(flags)), args...)
+	for _, extra := range flags {
+		flag, _ := cmd.findFlagByName(extra.name)
+		if flag == nil || given[flag] || (!flag.isFlag && !extra.hasValue) {
+			continue
+		}
+
+		given[flag] = true
+		switch {
+		case flag.isFlag && extra.hasValue:
+			withFlags = append(withFlags, extra.name+"="+extra.value)
+		case extra.hasValue:
+			withFlags = append(withFlags, extra.name, extra.value)
+		default:
+			withFlags = append(withFlags, extra.name)
+		}
+	}
+
+	return withFlags
+}
+
+// complete returns the completions of the last word of the line, see Command.completions.
+func (s *shell) complete(line string) []completion {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		return nil
+	}
+
+	var word string
+	if len(args) > 0 && line != "" && !unicode.IsSpace(rune(line[len(line)-1])) {
+		word, args = args[len(args)-1], args[:len(args)-1]
+	}
+
+	return s.root.completions(args, word)
+}
+
+// loadHistory reads the newest lines from the history file, it is not an error for the file not to exist.
+func (s *shell) loadHistory() []string {
+	if s.historyFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.historyFile)
+	if err != nil {
+		return nil
+	}
+
+	history := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			history = append(history, line)
+		}
+	}
+
+	if len(history) > maxShellHistory {
+		history = history[len(history)-maxShellHistory:]
+	}
+
+	return history
+}
+
+// addHistory adds the line to the history of an interactive shell and appends it to the history file, the values of
+// any secret flags are redacted first. A line which is the same as the one before it is only kept once.
+func (s *shell) addHistory(line string, args []string) {
+	if s.editor == nil {
+		return
+	}
+
+	line = strings.TrimSpace(line)
+	if redacted := s.root.RedactArgs(args); strings.Join(redacted, "\x00") != strings.Join(args, "\x00") {
+		line = joinCommandLine(redacted)
+	}
+
+	history := s.editor.history
+	if len(history) > 0 && history[len(history)-1] == line {
+		return
+	}
+
+	s.editor.history = append(history, line)
+	if len(s.editor.history) > maxShellHistory {
+		s.editor.history = s.editor.history[1:]
+	}
+
+	if s.historyFile == "" {
+		return
+	}
+
+	file, err := os.OpenFile(s.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = fmt.Fprintln(file, line)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	// The history is a convenience so the shell carries on without it, only warning the first time it can't be saved
+	if err != nil && !s.historyErr {
+		s.historyErr = true
+		s.ctx.printWarning("Warning: unable to save the shell history: %s\n", err.Error())
+	}
+}
+
+// completions returns the completions of word for the command named by args, which are the arguments before it. These
+// are the subcommands of the command, its flags once a flag has been given or word starts with "-", or the choices of
+// the flag the word is the value of. Hidden commands and flags are not included, the description of a flag in a group
+// names the group.
+func (c *Command) completions(args []string, word string) []completion {
+	cmd, flags := c, false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			flags = true
+			break
+		}
+
+		var next *Command
+		for _, sub := range cmd.Commands {
+			if sub.Name == arg {
+				next = sub
+				break
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		cmd = next
+	}
+
+	cmd.initialize()
+	completions := make([]completion, 0)
+
+	if last := len(args) - 1; last >= 0 && strings.HasPrefix(args[last], "-") {
+		if flag, _ := cmd.findFlagByName(args[last]); flag != nil && !flag.isFlag {
+			for _, choice := range flag.choices {
+				if strings.HasPrefix(choice, word) {
+					completions = append(completions, completion{text: choice})
+				}
+			}
+
+			return completions
+		}
+	}
+
+	if !flags && !strings.HasPrefix(word, "-") && cmd.hasCommands() {
+		for _, sub := range cmd.Commands {
+			if !sub.Hidden && strings.HasPrefix(sub.Name, word) {
+				completions = append(completions, completion{text: sub.Name, desc: sub.Desc})
+			}
+		}
+	} else {
+		for _, flag := range cmd.Flags {
+			if flag.hidden || flag.long == "" || !strings.HasPrefix("--"+flag.long, word) {
+				continue
+			}
+
+			desc := flag.desc
+			if flag.group != "" {
+				desc = strings.TrimSpace(desc + " [group: " + flag.group + "]")
+			}
+
+			completions = append(completions, completion{text: "--" + flag.long, desc: desc})
+		}
+	}
+
+	sort.Slice(completions, func(i, j int) bool { return completions[i].text < completions[j].text })
+	return completions
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockShellInput replaces stdin of the shell with the given input for the duration of the test.
+func mockShellInput(t *testing.T, input string, terminal bool) {
+	origInput, origIsTerminal, origMakeRaw := shellInput, shellIsTerminal, shellMakeRaw
+	t.Cleanup(func() {
+		shellInput, shellIsTerminal, shellMakeRaw = origInput, origIsTerminal, origMakeRaw
+	})
+
+	shellInput = strings.NewReader(input)
+	shellIsTerminal = func() bool { return terminal }
+	shellMakeRaw = func() (func(), error) { return func() {}, nil }
+}
+
+// shellTestCLI returns a CLI with the shell enabled, the commands it runs are recorded in the returned slice.
+func shellTestCLI(t *testing.T) (*CLI, *[]string) {
+	var (
+		cluster, password, name, bucketType string
+		verify                              bool
+		ran                                 []string
+	)
+
+	record := func(ctx context.Context, path []string) error {
+		ran = append(ran, fmt.Sprintf("%s %s %s %s %s %t", strings.Join(path, " "), cluster, password, name,
+			bucketType, verify))
+		return nil
+	}
+
+	connectionFlags := func(cmd *Command) {
+		cmd.AddFlag(StringFlag(&cluster, "", "c", "cluster", "", "", []string{}, nil, true, false))
+		cmd.AddFlag(StringFlag(&password, "", "p", "password", "", "", []string{}, nil, true, false).SetSecret(true))
+		cmd.AddFlag(NoSSLVerifyFlag(&verify, []string{}, false, false))
+	}
+
+	list := NewCommand("bucket-list", "Lists the buckets", "", nil)
+	list.RunE = record
+	connectionFlags(list)
+
+	create := NewCommand("bucket-create", "Creates a bucket", "", nil)
+	create.RunE = record
+	connectionFlags(create)
+	create.AddFlag(StringFlag(&name, "", "", "name", "", "", []string{}, nil, true, false))
+	create.AddFlag(EnumFlag(&bucketType, "couchbase", []string{"couchbase", "ephemeral", "memcached"}, "", "type",
+		"", "", []string{}, false, false))
+	create.AddFlag(StringFlag(&name, "", "", "internal", "", "", []string{}, nil, false, true))
+
+	cli := NewCLI("cb", "")
+	cli.Shell = &ShellConfig{
+		HistoryFile:     filepath.Join(t.TempDir(), "history"),
+		PersistentFlags: []string{"cluster", "password", "no-ssl-verify"},
+	}
+	cli.AddCommand(list)
+	cli.AddCommand(create)
+	cli.AddCommand(&Command{Name: "bucket-compact", Hidden: true})
+
+	return cli, &ran
+}
+
+func TestShell(t *testing.T) {
+	cli, ran := shellTestCLI(t)
+	output := captureWriter(t, cli)
+
+	mockShellInput(t, strings.Join([]string{
+		"bucket-list -c localhost -p secret --no-ssl-verify",
+		"",
+		`bucket-create --name "my bucket"`,
+		"  bucket-create --name=b2 -c other --type ephemeral",
+		"bucket-list --password=changed",
+		"exit",
+		"bucket-list",
+	}, "\n"), false)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "shell"}))
+	require.Equal(t, []string{
+		"cb bucket-list localhost secret  couchbase true",
+		"cb bucket-create localhost secret my bucket couchbase true",
+		"cb bucket-create other secret b2 ephemeral true",
+		"cb bucket-list other changed  couchbase true",
+	}, *ran)
+	require.Empty(t, output())
+
+	// History is only kept when stdin is a terminal
+	require.NoFileExists(t, cli.Shell.HistoryFile)
+}
+
+func TestShellErrors(t *testing.T) {
+	cli, ran := shellTestCLI(t)
+	output := captureWriter(t, cli)
+
+	mockShellInput(t, strings.Join([]string{
+		"bucket-list -c localhost -p secret",
+		`bucket-list --name "unterminated`,
+		"bucket-delete",
+		"shell",
+		"bucket-create",
+	}, "\n"), false)
+
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "shell"}))
+	require.Equal(t, []string{"cb bucket-list localhost secret  couchbase false"}, *ran)
+	require.Contains(t, output(), "Error: unterminated quote\n")
+	require.Contains(t, output(), "Invalid subcommand `bucket-delete`")
+	require.Contains(t, output(), "Error: the shell is already running\n")
+	require.Contains(t, output(), "Flag required, but not specified: --name")
+
+	mockShellInput(t, "bucket-list -c localhost -p secret\n", false)
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "shell"}))
+
+	mockShellInput(t, "", false)
+	require.Equal(t, ExitCodeCLIUsageError, cli.Execute(context.Background(), []string{"cb", "shell", "--all"}))
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "shell", "-h"}))
+	require.Contains(t, output(), "cb shell [<args>]")
+}
+
+func TestShellInteractive(t *testing.T) {
+	cli, ran := shellTestCLI(t)
+	output := captureWriter(t, cli)
+	cli.Shell.Prompt = "couchbase> "
+
+	require.NoError(t, ioutil.WriteFile(cli.Shell.HistoryFile, []byte("bucket-list -c old -p *****\n"), 0600))
+
+	mockShellInput(t, strings.Join([]string{
+		"bucket-li\t-c localhost -p secret",
+		"bucket-cr\t--na\tb1 --ty\tep\t",
+		"\x1b[A",
+		"\x1b[A\x1b[A\x1b[A\x15bucket-list",
+		"\x04",
+	}, "\r"), true)
+
+	require.Equal(t, ExitCodeSuccess, cli.Execute(context.Background(), []string{"cb", "shell"}))
+	require.Equal(t, []string{
+		"cb bucket-list localhost secret  couchbase false",
+		"cb bucket-create localhost secret b1 ephemeral false",
+		"cb bucket-create localhost secret b1 ephemeral false",
+		"cb bucket-list localhost secret  couchbase false",
+	}, *ran)
+	require.Contains(t, output(), "\rcouchbase> ")
+
+	history, err := ioutil.ReadFile(cli.Shell.HistoryFile)
+	require.NoError(t, err)
+	require.Equal(t, "bucket-list -c old -p *****\n"+
+		"bucket-list -c localhost -p *****\n"+
+		"bucket-create --name b1 --type ephemeral\n"+
+		"bucket-list\n", string(history))
+}
+
+func TestCompletions(t *testing.T) {
+	cli, _ := shellTestCLI(t)
+	cli.HelpCommand = true
+	root := cli.rootCommand(nil)
+
+	tests := []struct {
+		name     string
+		args     []string
+		word     string
+		expected []string
+	}{
+		{name: "Commands", expected: []string{"bucket-create", "bucket-list", "help", "shell"}},
+		{name: "CommandPrefix", word: "bucket-c", expected: []string{"bucket-create"}},
+		{name: "Flags", args: []string{"bucket-list"}, expected: []string{"--cluster", "--help", "--no-ssl-verify",
+			"--password"}},
+		{name: "FlagPrefix", args: []string{"bucket-create", "--name", "b1"}, word: "--n",
+			expected: []string{"--name", "--no-ssl-verify"}},
+		{name: "Choices", args: []string{"bucket-create", "--type"}, word: "e", expected: []string{"ephemeral"}},
+		{name: "FlagValue", args: []string{"bucket-create", "--name"}, word: "b", expected: []string{}},
+		{name: "UnknownCommand", args: []string{"bucket-delete"}, expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var texts []string
+			if completions := root.completions(test.args, test.word); completions != nil {
+				texts = make([]string, 0, len(completions))
+				for _, completion := range completions {
+					texts = append(texts, completion.text)
+				}
+			}
+
+			require.Equal(t, test.expected, texts)
+		})
+	}
+}
+
+func TestCompletionDescriptions(t *testing.T) {
+	cli, _ := shellTestCLI(t)
+	root := cli.rootCommand(nil)
+
+	for _, cmd := range cli.Commands {
+		if flag, _ := cmd.findFlagByName("--cluster"); flag != nil {
+			flag.desc = "The cluster to connect to"
+			flag.SetGroup("Connection")
+		}
+	}
+
+	require.Equal(t, []completion{{text: "bucket-create", desc: "Creates a bucket"}},
+		root.completions(nil, "bucket-c"))
+	require.Equal(t, []completion{{text: "--cluster", desc: "The cluster to connect to [group: Connection]"}},
+		root.completions([]string{"bucket-list"}, "--c"))
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitCommandLine splits a command line into arguments using shell-like quoting rules. Arguments are separated by
+// whitespace, single quotes preserve everything up to the closing quote, double quotes allow \" and \\ to be escaped
+// and a backslash outside of quotes escapes the next character.
+func splitCommandLine(line string) ([]string, error) {
+	return splitCommandLineExpand(line, nil)
+}
+
+// expandFunc returns the text to use in place of the $ at the start of s, along with the number of bytes it replaces.
+type expandFunc func(s string) (string, int, error)
+
+// splitCommandLineExpand is the same as splitCommandLine except that expand, if it is not nil, is called for each $
+// which is not escaped or single quoted. Errors returned by expand are prefixed with the column of the $.
+func splitCommandLineExpand(line string, expand expandFunc) ([]string, error) {
+	var (
+		args    = make([]string, 0)
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == '$' && expand != nil && !escaped && quote != '\'' {
+			value, n, err := expand(line[i:])
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %w", utf8.RuneCountInString(line[:i])+1, err)
+			}
+
+			current.WriteString(value)
+			inArg = true
+			i += n
+			continue
+		}
+
+		i += size
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if escaped {
+		return nil, errors.New("unterminated escape")
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// joinCommandLine is the inverse of splitCommandLine, arguments which are empty or contain whitespace, quotes or
+// backslashes are single quoted so that splitting the result gives back the same arguments.
+func joinCommandLine(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		special := strings.IndexFunc(arg, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '\'' || r == '"' || r == '\\'
+		})
+
+		if arg != "" && special == -1 {
+			quoted = append(quoted, arg)
+		} else {
+			quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+		err      bool
+	}{
+		{name: "Empty", line: "", expected: []string{}},
+		{name: "Whitespace", line: " \t ", expected: []string{}},
+		{name: "Simple", line: "cb bucket-create  -c\tlocalhost", expected: []string{"cb", "bucket-create", "-c",
+			"localhost"}},
+		{name: "SingleQuotes", line: `-p 'pass "word\'`, expected: []string{"-p", `pass "word\`}},
+		{name: "DoubleQuotes", line: `-p "pass 'w\"o\\rd"`, expected: []string{"-p", `pass 'w"o\rd`}},
+		{name: "Adjacent", line: `--name=my' 'bucket""`, expected: []string{"--name=my bucket"}},
+		{name: "EmptyQuotes", line: `-p ''`, expected: []string{"-p", ""}},
+		{name: "Backslash", line: `a\ b c\\d`, expected: []string{"a b", `c\d`}},
+		{name: "Unicode", line: "--name 日本", expected: []string{"--name", "日本"}},
+		{name: "UnterminatedQuote", line: `-p "pass`, err: true},
+		{name: "UnterminatedEscape", line: `-p pass\`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := splitCommandLine(test.line)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expected, args)
+		})
+	}
+}
+
+func TestJoinCommandLine(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"cb", "bucket-create", "-c", "localhost"},
+		{"--name", "my bucket"},
+		{"-p", `pass 'w"o\rd`},
+		{"-p", ""},
+		{"--name", "日本", "tab\tseparated"},
+	}
+
+	for _, args := range tests {
+		split, err := splitCommandLine(joinCommandLine(args))
+		require.NoError(t, err)
+		require.Equal(t, args, split)
+	}
+
+	require.Equal(t, `cb -p 'it'\''s' ''`, joinCommandLine([]string{"cb", "-p", "it's", ""}))
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// UsageFormatter renders the help output for a command, it can be set on the CLI to change the layout of the help.
+type UsageFormatter interface {
+	FormatUsage(data *UsageData) (string, error)
+}
+
+// UsageData is the data model of a command which is passed to a UsageFormatter.
+type UsageData struct {
+	// Title is the usage line for the command (e.g. "couchbase-cli bucket-create [<args>]"), it is empty when only
+	// the body of the usage has been requested.
+	Title string
+
+	// Path is the names of the commands which lead to this one, including the command itself.
+	Path     []string
+	Name     string
+	Desc     string
+	LongDesc string
+	ManPage  string
+
+	// Commands and Flags contain the subcommands and flags of the command which should be shown in the help. Hidden
+	// flags are never included, so a section such as "Required Flags" is left out when all of its flags are hidden.
+	Commands []*UsageCommand
+	Flags    []*UsageFlag
+	Examples []Example
+
+	// Plugins are the external executables which implement subcommands of the command, see CLI.Plugins. The
+	// description of each is the path of the executable. They are not included in the usage shown for parse errors.
+	Plugins []*UsageCommand
+
+	// ExitCodes are the exit codes of the tool, they are only set for the root command.
+	ExitCodes []ExitCodeInfo
+
+	// Width is the width of the terminal the help is being rendered for.
+	Width int
+
+	// Annotations are the annotations requested for the flag descriptions.
+	Annotations HelpAnnotation
+
+	// Color is whether the help should be styled using ANSI escape sequences.
+	Color bool
+}
+
+// UsageCommand is the data model of a subcommand which is passed to a UsageFormatter.
+type UsageCommand struct {
+	Name string
+	Desc string
+
+	// Hidden is only ever true when hidden commands have been requested, such as by "help --all", as they are left out
+	// otherwise.
+	Hidden bool
+}
+
+// UsageFlag is the data model of a flag which is passed to a UsageFormatter.
+type UsageFlag struct {
+	Short string
+	Long  string
+	Env   string
+	Desc  string
+
+	// Names is the flag names as shown in the default layout (e.g. "-c,--cluster").
+	Names string
+
+	// Default is the default value of the flag, it is always empty for secret flags.
+	Default string
+
+	// Group is the name of the group the flag belongs to, empty if it is not in a group.
+	Group string
+
+	Deprecated []string
+	Required   bool
+	Secret     bool
+	IsBool     bool
+
+	flag *Flag
+}
+
+// UsageGroup is a named group of flags which is passed to a UsageFormatter.
+type UsageGroup struct {
+	Name  string
+	Flags []*UsageFlag
+}
+
+// RequiredFlags returns the flags which must be specified and are not in a group.
+func (d *UsageData) RequiredFlags() []*UsageFlag {
+	flags := make([]*UsageFlag, 0)
+	for _, flag := range d.Flags {
+		if flag.Required && flag.Group == "" {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+// OptionalFlags returns the flags which do not need to be specified and are not in a group.
+func (d *UsageData) OptionalFlags() []*UsageFlag {
+	flags := make([]*UsageFlag, 0)
+	for _, flag := range d.Flags {
+		if !flag.Required && flag.Group == "" {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+// Groups returns the groups of flags in the order they first appear, each group contains both required and optional
+// flags.
+func (d *UsageData) Groups() []*UsageGroup {
+	groups := make([]*UsageGroup, 0)
+	for _, flag := range d.Flags {
+		if flag.Group == "" {
+			continue
+		}
+
+		var group *UsageGroup
+		for _, existing := range groups {
+			if existing.Name == flag.Group {
+				group = existing
+				break
+			}
+		}
+
+		if group == nil {
+			group = &UsageGroup{Name: flag.Group}
+			groups = append(groups, group)
+		}
+
+		group.Flags = append(group.Flags, flag)
+	}
+
+	return groups
+}
+
+// CommandRows returns the subcommands formatted as an aligned list of names and descriptions, wrapped to the width.
+func (d *UsageData) CommandRows() string {
+	names, descs := make([]string, 0, len(d.Commands)), make([]string, 0, len(d.Commands))
+	for _, cmd := range d.Commands {
+		names, descs = append(names, cmd.Name), append(descs, cmd.Desc)
+	}
+
+	return alignedRows(names, descs, d.Width)
+}
+
+// PluginRows returns the plugins formatted as an aligned list of names and paths, wrapped to the width.
+func (d *UsageData) PluginRows() string {
+	names, paths := make([]string, 0, len(d.Plugins)), make([]string, 0, len(d.Plugins))
+	for _, plugin := range d.Plugins {
+		names, paths = append(names, plugin.Name), append(paths, plugin.Desc)
+	}
+
+	return alignedRows(names, paths, d.Width)
+}
+
+// ExitCodeRows returns the exit codes formatted as an aligned list of codes and descriptions, wrapped to the width.
+func (d *UsageData) ExitCodeRows() string {
+	codes, descs := make([]string, 0, len(d.ExitCodes)), make([]string, 0, len(d.ExitCodes))
+	for _, info := range d.ExitCodes {
+		codes, descs = append(codes, strconv.Itoa(int(info.Code))), append(descs, info.Desc)
+	}
+
+	return alignedRows(codes, descs, d.Width)
+}
+
+// alignedRows returns the names and descriptions formatted as a list with the descriptions aligned and wrapped to the
+// width.
+func alignedRows(names, descs []string, width int) string {
+	maxLen := 0
+	for _, name := range names {
+		if displayWidth(name) > maxLen {
+			maxLen = displayWidth(name)
+		}
+	}
+
+	s := ""
+	descCol := PREFIX_LEN + maxLen + POSTFIX_LEN
+	for idx, name := range names {
+		spaces := strings.Repeat(" ", maxLen-displayWidth(name))
+		lines := wrapText(descs[idx], width-descCol)
+		s += strings.TrimRight(fmt.Sprintf("  %s%s   %s", name, spaces, lines[0]), " ") + "\n"
+		for _, line := range lines[1:] {
+			s += strings.TrimRight(strings.Repeat(" ", descCol)+line, " ") + "\n"
+		}
+	}
+
+	return s
+}
+
+// FlagRow returns the flag formatted as a row of the default layout, with the annotated description wrapped to the
+// width.
+func (d *UsageData) FlagRow(flag *UsageFlag) string {
+	return flag.flag.usageString(d.Width, d.Annotations, styler(d.Color))
+}
+
+// Heading returns the text styled as a section heading if color is enabled.
+func (d *UsageData) Heading(text string) string {
+	return styler(d.Color).heading(text)
+}
+
+// FlagName returns the text styled as a flag name if color is enabled.
+func (d *UsageData) FlagName(text string) string {
+	return styler(d.Color).flag(text)
+}
+
+// FlagDesc returns the description of the flag followed by the annotations requested for the help.
+func (d *UsageData) FlagDesc(flag *UsageFlag) string {
+	return flag.flag.annotatedDesc(d.Annotations)
+}
+
+// WrapIndent returns the text wrapped to the width once indented by the given number of spaces.
+func (d *UsageData) WrapIndent(spaces int, text string) string {
+	lines := wrapText(text, d.Width-spaces)
+	for idx, line := range lines {
+		if line != "" {
+			lines[idx] = strings.Repeat(" ", spaces) + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// DefaultUsageTemplate is the template used to render the default help layout, it can be used as the starting point
+// for a custom layout with NewTemplateUsageFormatter.
+const DefaultUsageTemplate = `
+{{- if .Title}}{{.Title}}
+
+{{end}}
+{{- if .Commands}}{{.CommandRows}}
+{{end}}
+{{- if .Plugins}}{{$.Heading "Plugin Commands:"}}
+
+{{.PluginRows}}
+{{end}}
+{{- with .RequiredFlags}}{{$.Heading "Required Flags:"}}
+
+{{range .}}{{$.FlagRow .}}{{end}}
+{{end}}
+{{- with .OptionalFlags}}{{$.Heading "Optional Flags:"}}
+
+{{range .}}{{$.FlagRow .}}{{end}}
+{{end}}
+{{- range .Groups}}{{$.Heading (print .Name ":")}}
+
+{{range .Flags}}{{$.FlagRow .}}{{end}}
+{{end}}
+{{- with .LongDesc}}{{$.Heading "Description:"}}
+
+{{$.WrapIndent 2 .}}
+
+{{end}}
+{{- with .Examples}}{{$.Heading "Examples:"}}
+
+{{range .}}{{with .Desc}}{{$.WrapIndent 2 .}}
+
+{{end}}    $ {{.CommandLine}}
+
+{{end}}{{end}}
+{{- if .ExitCodes}}{{$.Heading "Exit Codes:"}}
+
+{{.ExitCodeRows}}
+{{end}}`
+
+var defaultUsageFormatter = &TemplateUsageFormatter{
+	tmpl: template.Must(template.New("usage").Funcs(usageFuncs).Parse(DefaultUsageTemplate)),
+}
+
+// usageFuncs are the functions available to usage templates in addition to the methods of UsageData.
+var usageFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"roff":  roff,
+	"wrap": func(width int, text string) string {
+		return strings.Join(wrapText(text, width), "\n")
+	},
+	"indent": func(spaces int, text string) string {
+		lines := strings.Split(text, "\n")
+		for idx, line := range lines {
+			if line != "" {
+				lines[idx] = strings.Repeat(" ", spaces) + line
+			}
+		}
+
+		return strings.Join(lines, "\n")
+	},
+}
+
+// TemplateUsageFormatter is a UsageFormatter which renders the help using a text/template, the template is executed
+// with *UsageData and can use the "join", "upper", "wrap" and "indent" functions, along with "roff" which escapes text
+// for use in a man page.
+type TemplateUsageFormatter struct {
+	tmpl *template.Template
+}
+
+// NewTemplateUsageFormatter parses the template text and returns a formatter which renders the help using it.
+func NewTemplateUsageFormatter(text string) (*TemplateUsageFormatter, error) {
+	tmpl, err := template.New("usage").Funcs(usageFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateUsageFormatter{tmpl}, nil
+}
+
+func (f *TemplateUsageFormatter) FormatUsage(data *UsageData) (string, error) {
+	var s strings.Builder
+	if err := f.tmpl.Execute(&s, data); err != nil {
+		return "", err
+	}
+
+	return s.String(), nil
+}
+
+// fullUsage returns the usage title followed by the usage for the command, rendered by the formatter configured on
+// the CLI.
+func (c *Command) fullUsage(ctx *Context) string {
+	return c.renderFullUsage(ctx, false, true, ctx.style, ctx.out())
+}
+
+// fullUsageShowHidden is the same as fullUsage but optionally includes hidden subcommands.
+func (c *Command) fullUsageShowHidden(ctx *Context, showHidden bool) string {
+	return c.renderFullUsage(ctx, showHidden, true, ctx.style, ctx.out())
+}
+
+// errorUsage is the same as fullUsage but styled for the error writer, it is shown alongside usage errors. Plugins are
+// not listed so that the directories in PATH are only searched when the help has been asked for.
+func (c *Command) errorUsage(ctx *Context) string {
+	return c.renderFullUsage(ctx, false, false, ctx.errStyle, ctx.errOut())
+}
+
+func (c *Command) renderFullUsage(ctx *Context, showHidden, plugins bool, style styler, writer io.Writer) string {
+	data := c.usageData(ctx.cli.HelpAnnotations, showHidden, writer)
+	data.Title = strings.TrimSuffix(c.usageTitle(ctx), "\n\n")
+	data.Path = append([]string{}, ctx.prevCmds...)
+	data.Color = bool(style)
+	if plugins {
+		data.Plugins = ctx.cli.usagePlugins(ctx.prevCmds, c)
+	}
+	if len(ctx.prevCmds) == 1 {
+		data.ExitCodes = ctx.cli.usageExitCodes()
+	}
+
+	return renderUsage(ctx.cli.UsageFormatter, data)
+}
+
+func (c *Command) Usage() string {
+	return renderUsage(nil, c.usageData(0, false, os.Stdout))
+}
+
+// renderUsage renders the data using the formatter, falling back to the default layout if there isn't a formatter or
+// it fails.
+func renderUsage(formatter UsageFormatter, data *UsageData) string {
+	if formatter != nil {
+		s, err := formatter.FormatUsage(data)
+		if err == nil {
+			return s
+		}
+
+		defaultUsage, _ := defaultUsageFormatter.FormatUsage(data)
+		return fmt.Sprintf("Unable to render usage: %s\n\n%s", err.Error(), defaultUsage)
+	}
+
+	// The default template only calls methods which cannot fail
+	s, _ := defaultUsageFormatter.FormatUsage(data)
+	return s
+}
+
+// usageData returns the data model of the command used to render its help to the writer, hidden subcommands are only
+// included if showHidden is true.
+func (c *Command) usageData(annotations HelpAnnotation, showHidden bool, writer io.Writer) *UsageData {
+	data := &UsageData{
+		Path:        []string{c.Name},
+		Name:        c.Name,
+		Desc:        c.Desc,
+		LongDesc:    c.LongDesc,
+		ManPage:     c.ManPage,
+		Examples:    c.Examples,
+		Commands:    make([]*UsageCommand, 0),
+		Flags:       make([]*UsageFlag, 0),
+		Width:       helpWidth(writer),
+		Annotations: annotations,
+	}
+
+	for _, cmd := range c.Commands {
+		if !cmd.Hidden || showHidden {
+			data.Commands = append(data.Commands, &UsageCommand{Name: cmd.Name, Desc: cmd.Desc, Hidden: cmd.Hidden})
+		}
+	}
+
+	for _, flag := range c.Flags {
+		if !flag.hidden {
+			data.Flags = append(data.Flags, flag.usageData())
+		}
+	}
+
+	return data
+}
+
+// usageData returns the data model of the flag used to render help.
+func (f *Flag) usageData() *UsageFlag {
+	data := &UsageFlag{
+		Short:      f.short,
+		Long:       f.long,
+		Env:        f.env,
+		Desc:       f.desc,
+		Names:      strings.TrimSpace(f.flagsHelpString()),
+		Group:      f.group,
+		Deprecated: f.deprecated,
+		Required:   f.required,
+		Secret:     f.secret,
+		IsBool:     f.isFlag,
+		flag:       f,
+	}
+
+	if f.hasDefault() {
+		data.Default = f.defValue
+	}
+
+	return data
+}
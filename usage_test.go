@@ -0,0 +1,145 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// usageTestCommand returns a command with subcommands and flags used to test rendering usage.
+func usageTestCommand() *Command {
+	var host, name string
+
+	command := NewCommand("bucket", "Manage buckets", "", func() {})
+	command.AddCommand(NewCommand("create", "Creates a bucket", "", func() {}))
+	command.AddCommand(NewCommand("delete-all", "Deletes all of the buckets", "", func() {}))
+	command.AddCommand(&Command{Name: "secret", Hidden: true})
+	command.AddFlag(HostFlag(&host, "", []string{}, true, false))
+	command.AddFlag(StringFlag(&name, "", "n", "name", "", "The name of the bucket", []string{}, nil, false, false))
+	command.AddFlag(StringFlag(&name, "", "", "internal", "", "", []string{}, nil, false, true))
+
+	return command
+}
+
+func TestFullUsageDefault(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	ctx := &Context{cli: NewCLI("cb", ""), prevCmds: []string{"cb", "bucket"}}
+	require.Equal(t, "cb bucket [<command>] [<args>]\n\n"+
+		"  create       Creates a bucket\n"+
+		"  delete-all   Deletes all of the buckets\n\n"+
+		"Required Flags:\n\n"+
+		"  -c,--cluster                The hostname of the Couchbase cluster\n\n"+
+		"Optional Flags:\n\n"+
+		"  -n,--name                   The name of the bucket\n\n", usageTestCommand().fullUsage(ctx))
+}
+
+func TestFullUsageHidden(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	var token string
+	command := usageTestCommand()
+	command.AddFlag(StringFlag(&token, "", "", "token", "", "", []string{}, nil, true, true))
+	command.Flags[0].hidden = true
+
+	// The required flags section is left out rather than shown empty as all of the required flags are hidden
+	ctx := &Context{cli: NewCLI("cb", ""), prevCmds: []string{"cb", "bucket"}}
+	require.Equal(t, "cb bucket [<command>] [<args>]\n\n"+
+		"  create       Creates a bucket\n"+
+		"  delete-all   Deletes all of the buckets\n\n"+
+		"Optional Flags:\n\n"+
+		"  -n,--name                   The name of the bucket\n\n", command.fullUsage(ctx))
+
+	data := command.usageData(0, false, nil)
+	require.Len(t, data.Commands, 2)
+	require.False(t, data.Commands[0].Hidden)
+	require.False(t, data.Commands[1].Hidden)
+
+	data = command.usageData(0, true, nil)
+	require.Len(t, data.Commands, 3)
+	require.True(t, data.Commands[2].Hidden)
+	require.Len(t, data.Flags, 1)
+}
+
+func TestFullUsageTemplate(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	formatter, err := NewTemplateUsageFormatter(`Usage: {{.Title}}
+{{range .Commands}}* {{.Name}}: {{.Desc}}
+{{end}}{{range .Flags}}{{.Names}}{{if .Required}} (required){{end}}
+{{wrap 20 .Desc | indent 4}}
+{{end}}See {{join .Path "-"}}.html`)
+	require.NoError(t, err)
+
+	cli := NewCLI("cb", "")
+	cli.UsageFormatter = formatter
+
+	ctx := &Context{cli: cli, prevCmds: []string{"cb", "bucket"}}
+	require.Equal(t, "Usage: cb bucket [<command>] [<args>]\n"+
+		"* create: Creates a bucket\n"+
+		"* delete-all: Deletes all of the buckets\n"+
+		"-c,--cluster (required)\n"+
+		"    The hostname of the\n"+
+		"    Couchbase cluster\n"+
+		"-n,--name\n"+
+		"    The name of the\n"+
+		"    bucket\n"+
+		"See cb-bucket.html", usageTestCommand().fullUsage(ctx))
+}
+
+func TestFullUsageTemplateError(t *testing.T) {
+	mockTerminalWidth(t, 0)
+
+	_, err := NewTemplateUsageFormatter(`{{.Missing`)
+	require.Error(t, err)
+
+	formatter, err := NewTemplateUsageFormatter(`{{.Missing}}`)
+	require.NoError(t, err)
+
+	cli := NewCLI("cb", "")
+	cli.UsageFormatter = formatter
+
+	ctx := &Context{cli: cli, prevCmds: []string{"cb", "bucket"}}
+	require.Contains(t, usageTestCommand().fullUsage(ctx), "Unable to render usage: ")
+	require.Contains(t, usageTestCommand().fullUsage(ctx), "Required Flags:\n\n")
+}
+
+func TestFullUsageGroups(t *testing.T) {
+	var (
+		host, user, key, name string
+		threads               int
+	)
+
+	mockTerminalWidth(t, 0)
+
+	command := NewCommand("backup", "", "", func() {})
+	command.AddFlag(StringFlag(&name, "", "n", "name", "", "The name of the backup", []string{}, nil, true, false))
+	command.AddFlag(HostFlag(&host, "", []string{}, true, false).SetGroup("Connection"))
+	command.AddFlag(IntFlag(&threads, 1, "t", "threads", "", "The number of threads", []string{}, nil, false,
+		false).SetGroup("Performance"))
+	command.AddFlag(UsernameFlag(&user, "", []string{}, false, false).SetGroup("Connection"))
+	command.AddFlag(StringFlag(&key, "", "", "key", "", "The encryption key", []string{}, nil, false,
+		false).SetGroup("Encryption"))
+
+	ctx := &Context{cli: NewCLI("cb", ""), prevCmds: []string{"cb", "backup"}}
+	require.Equal(t, "cb backup [<args>]\n\n"+
+		"Required Flags:\n\n"+
+		"  -n,--name                   The name of the backup\n\n"+
+		"Connection:\n\n"+
+		"  -c,--cluster                The hostname of the Couchbase cluster [required]\n"+
+		"  -u,--username               The username of the Couchbase cluster\n\n"+
+		"Performance:\n\n"+
+		"  -t,--threads                The number of threads\n\n"+
+		"Encryption:\n\n"+
+		"     --key                    The encryption key\n\n", command.fullUsage(ctx))
+}
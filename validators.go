@@ -15,6 +15,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 type HostNameError struct {
@@ -124,3 +125,16 @@ func HostValidator(value Value) error {
 	value.Set(parsed.String()) //nolint:errcheck
 	return nil
 }
+
+// EnumValidator returns a validator which only accepts values that are in the given list of choices.
+func EnumValidator(choices []string) ValidatorFn {
+	return func(value Value) error {
+		for _, choice := range choices {
+			if value.String() == choice {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("Invalid value `%s`, expected one of: %s", value.String(), strings.Join(choices, ", "))
+	}
+}
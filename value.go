@@ -36,6 +36,16 @@ func (b *boolValue) Get() interface{} { return bool(*b) }
 
 func (b *boolValue) String() string { return fmt.Sprintf("%v", *b) }
 
+func (b *boolValue) snapshot() func() {
+	saved := *b
+	return func() { *b = saved }
+}
+
+func (b *boolValue) clone() Value {
+	cloned := *b
+	return &cloned
+}
+
 func (b *boolValue) IsBoolFlag() bool { return true }
 
 // -- int Value
@@ -56,6 +66,16 @@ func (i *intValue) Get() interface{} { return int(*i) }
 
 func (i *intValue) String() string { return fmt.Sprintf("%v", *i) }
 
+func (i *intValue) snapshot() func() {
+	saved := *i
+	return func() { *i = saved }
+}
+
+func (i *intValue) clone() Value {
+	cloned := *i
+	return &cloned
+}
+
 // -- int64 Value
 type int64Value int64
 
@@ -74,6 +94,16 @@ func (i *int64Value) Get() interface{} { return int64(*i) }
 
 func (i *int64Value) String() string { return fmt.Sprintf("%v", *i) }
 
+func (i *int64Value) snapshot() func() {
+	saved := *i
+	return func() { *i = saved }
+}
+
+func (i *int64Value) clone() Value {
+	cloned := *i
+	return &cloned
+}
+
 // -- uint Value
 type uintValue uint
 
@@ -92,6 +122,16 @@ func (i *uintValue) Get() interface{} { return uint(*i) }
 
 func (i *uintValue) String() string { return fmt.Sprintf("%v", *i) }
 
+func (i *uintValue) snapshot() func() {
+	saved := *i
+	return func() { *i = saved }
+}
+
+func (i *uintValue) clone() Value {
+	cloned := *i
+	return &cloned
+}
+
 // -- uint64 Value
 type uint64Value uint64
 
@@ -110,6 +150,16 @@ func (i *uint64Value) Get() interface{} { return uint64(*i) }
 
 func (i *uint64Value) String() string { return fmt.Sprintf("%v", *i) }
 
+func (i *uint64Value) snapshot() func() {
+	saved := *i
+	return func() { *i = saved }
+}
+
+func (i *uint64Value) clone() Value {
+	cloned := *i
+	return &cloned
+}
+
 // -- rune Value
 type runeValue rune
 
@@ -144,6 +194,16 @@ func (s *runeValue) Get() interface{} { return rune(*s) }
 
 func (s *runeValue) String() string { return string(*s) }
 
+func (s *runeValue) snapshot() func() {
+	saved := *s
+	return func() { *s = saved }
+}
+
+func (s *runeValue) clone() Value {
+	cloned := *s
+	return &cloned
+}
+
 // -- string Value
 type stringValue string
 
@@ -161,6 +221,16 @@ func (s *stringValue) Get() interface{} { return string(*s) }
 
 func (s *stringValue) String() string { return string(*s) }
 
+func (s *stringValue) snapshot() func() {
+	saved := *s
+	return func() { *s = saved }
+}
+
+func (s *stringValue) clone() Value {
+	cloned := *s
+	return &cloned
+}
+
 // -- stringMap Value
 type stringMapValue map[string]string
 
@@ -189,6 +259,31 @@ func (s *stringMapValue) Set(val string) error {
 
 func (s *stringMapValue) Get() interface{} { return map[string]string(*s) }
 
+func (s *stringMapValue) snapshot() func() {
+	saved := make(map[string]string, len(*s))
+	for key, value := range *s {
+		saved[key] = value
+	}
+
+	return func() {
+		restored := make(map[string]string, len(saved))
+		for key, value := range saved {
+			restored[key] = value
+		}
+
+		*s = restored
+	}
+}
+
+func (s *stringMapValue) clone() Value {
+	cloned := make(stringMapValue, len(*s))
+	for key, value := range *s {
+		cloned[key] = value
+	}
+
+	return &cloned
+}
+
 func (s *stringMapValue) String() string { return fmt.Sprintf("%s", *s) }
 
 // -- float64 Value
@@ -209,6 +304,16 @@ func (f *float64Value) Get() interface{} { return float64(*f) }
 
 func (f *float64Value) String() string { return fmt.Sprintf("%v", *f) }
 
+func (f *float64Value) snapshot() func() {
+	saved := *f
+	return func() { *f = saved }
+}
+
+func (f *float64Value) clone() Value {
+	cloned := *f
+	return &cloned
+}
+
 // -- int Array
 type intArray []int
 
@@ -237,8 +342,67 @@ func (i *intArray) Set(s string) error {
 
 func (i *intArray) Get() interface{} { return []int(*i) }
 
+func (i *intArray) snapshot() func() {
+	saved := append([]int(nil), *i...)
+	return func() { *i = append([]int(nil), saved...) }
+}
+
+func (i *intArray) clone() Value {
+	cloned := intArray(append([]int(nil), *i...))
+	return &cloned
+}
+
 func (i *intArray) String() string { return fmt.Sprintf("%v", *i) }
 
+// -- stringArray Value, each value is added as it is given rather than being split on commas.
+type stringArray []string
+
+func newStringArray(val []string, p *[]string) *stringArray {
+	*p = val
+	return (*stringArray)(p)
+}
+
+func (s *stringArray) Set(val string) error {
+	*s = append(*s, val)
+	return nil
+}
+
+func (s *stringArray) Get() interface{} { return []string(*s) }
+
+func (s *stringArray) snapshot() func() {
+	saved := append([]string(nil), *s...)
+	return func() { *s = append([]string(nil), saved...) }
+}
+
+func (s *stringArray) clone() Value {
+	cloned := stringArray(append([]string(nil), *s...))
+	return &cloned
+}
+
+func (s *stringArray) String() string { return fmt.Sprintf("%v", *s) }
+
+// snapshotter is implemented by all of the values provided by cbflag, the function returned by snapshot restores the
+// value to its state when snapshot was called.
+type snapshotter interface {
+	snapshot() func()
+}
+
+// cloner is implemented by all of the values provided by cbflag, clone returns a copy of the value which does not
+// share any storage with it.
+type cloner interface {
+	clone() Value
+}
+
+// isCollection returns whether the value adds to its contents each time it is set, such as a list or map.
+func isCollection(value Value) bool {
+	switch value.(type) {
+	case *intArray, *stringArray, *stringMapValue:
+		return true
+	}
+
+	return false
+}
+
 // Value is the interface to the dynamic value stored in a flag.
 // (The default value is represented as a string.)
 //
@@ -0,0 +1,133 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// VersionInfo describes the build of a tool, it is normally populated using -ldflags at build time. Any of the fields
+// which are empty are filled in from the build information embedded by the Go toolchain where possible.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion,omitempty"`
+}
+
+// Provide variable so that tests can provide a mock implementation.
+var readBuildInfo = debug.ReadBuildInfo
+
+// resolve returns a copy of the version information with any missing fields filled in from the build information.
+func (v *VersionInfo) resolve() *VersionInfo {
+	resolved := *v
+
+	info, ok := readBuildInfo()
+	if ok {
+		if resolved.Version == "" && info.Main.Version != "(devel)" {
+			resolved.Version = info.Main.Version
+		}
+
+		if resolved.GoVersion == "" {
+			resolved.GoVersion = info.GoVersion
+		}
+
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && resolved.GitCommit == "":
+				resolved.GitCommit = setting.Value
+			case setting.Key == "vcs.time" && resolved.BuildDate == "":
+				resolved.BuildDate = setting.Value
+			}
+		}
+	}
+
+	if resolved.GoVersion == "" {
+		resolved.GoVersion = runtime.Version()
+	}
+
+	return &resolved
+}
+
+// Text returns the version information as plain text, the first line contains the name of the tool and its version
+// with the remaining details on the following lines.
+func (v *VersionInfo) Text(name string) string {
+	version := v.Version
+	if version == "" {
+		version = "unknown"
+	}
+
+	s := fmt.Sprintf("%s version %s\n", name, version)
+	if v.GitCommit != "" {
+		s += fmt.Sprintf("Git commit: %s\n", v.GitCommit)
+	}
+
+	if v.BuildDate != "" {
+		s += fmt.Sprintf("Build date: %s\n", v.BuildDate)
+	}
+
+	if v.GoVersion != "" {
+		s += fmt.Sprintf("Go version: %s\n", v.GoVersion)
+	}
+
+	return s
+}
+
+// JSON returns the version information as an indented JSON object.
+func (v *VersionInfo) JSON() string {
+	// Marshalling a struct of strings cannot fail
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data) + "\n"
+}
+
+// newVersionCommand returns the built in version command.
+func newVersionCommand() *Command {
+	var asJSON bool
+
+	cmd := NewCommand("version", "Prints the version information", "", nil)
+	cmd.AddFlag(BoolFlag(&asJSON, false, "", "json", "", "Prints the version information as JSON", []string{}, false))
+
+	cmd.builtin = func(ctx *Context, args []string) ExitCode {
+		rest, exitCode, ok := cmd.parseBuiltinArgs(ctx, args)
+		if !ok {
+			return exitCode
+		}
+
+		if len(rest) > 0 {
+			// Unexpected argument, exit with a non-zero exit code
+			return cmd.parseError(ctx, &ConstraintError{Path: ctx.path(), Arg: rest[0],
+				Err: fmt.Errorf("Expected flag: %s", rest[0])})
+		}
+
+		return showVersionInfo(ctx, asJSON)
+	}
+
+	return cmd
+}
+
+// showVersionInfo prints the version information of the CLI, as JSON if asJSON is set.
+func showVersionInfo(ctx *Context, asJSON bool) ExitCode {
+	version := ctx.cli.Version
+	if version == nil {
+		version = &VersionInfo{}
+	}
+
+	if asJSON {
+		fmt.Fprint(ctx.out(), version.resolve().JSON())
+	} else {
+		fmt.Fprint(ctx.out(), version.resolve().Text(ctx.cli.Name))
+	}
+
+	return ExitCodeSuccess
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockBuildInfo replaces the build information embedded by the Go toolchain for the duration of a test.
+func mockBuildInfo(t *testing.T, info *debug.BuildInfo) {
+	orig := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return info, info != nil }
+	t.Cleanup(func() { readBuildInfo = orig })
+}
+
+func TestVersionInfoResolve(t *testing.T) {
+	mockBuildInfo(t, &debug.BuildInfo{
+		GoVersion: "go1.17.13",
+		Main:      debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.time", Value: "2021-10-01T12:00:00Z"},
+		},
+	})
+
+	require.Equal(t, &VersionInfo{Version: "7.1.0", GitCommit: "0123abcd", BuildDate: "2021-10-01T12:00:00Z",
+		GoVersion: "go1.17.13"}, (&VersionInfo{Version: "7.1.0"}).resolve())
+	require.Equal(t, &VersionInfo{Version: "7.1.0", GitCommit: "fedc", BuildDate: "today", GoVersion: "go1.17.13"},
+		(&VersionInfo{Version: "7.1.0", GitCommit: "fedc", BuildDate: "today"}).resolve())
+
+	mockBuildInfo(t, nil)
+	require.NotEmpty(t, (&VersionInfo{}).resolve().GoVersion)
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		command  bool
+		exitCode ExitCode
+		expected string
+	}{
+		{name: "Flag", args: []string{"--version"}, expected: "cb version 7.1.0\nGit commit: 0123abcd\n" +
+			"Go version: go1.17.13\n"},
+		{name: "Command", args: []string{"version"}, command: true, expected: "cb version 7.1.0\n" +
+			"Git commit: 0123abcd\nGo version: go1.17.13\n"},
+		{name: "CommandJSON", args: []string{"version", "--json"}, command: true, expected: "{\n" +
+			"  \"version\": \"7.1.0\",\n  \"gitCommit\": \"0123abcd\",\n  \"goVersion\": \"go1.17.13\"\n}\n"},
+		{name: "CommandJSONValue", args: []string{"version", "--json=false"}, command: true,
+			expected: "cb version 7.1.0\nGit commit: 0123abcd\nGo version: go1.17.13\n"},
+		{name: "CommandArgument", args: []string{"version", "json"}, command: true, exitCode: ExitCodeCLIUsageError},
+		{name: "CommandDisabled", args: []string{"version"}, exitCode: ExitCodeCLIUsageError},
+		{name: "CommandUnknownFlag", args: []string{"version", "--yaml"}, command: true,
+			exitCode: ExitCodeCLIUsageError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockBuildInfo(t, &debug.BuildInfo{GoVersion: "go1.17.13"})
+
+			cli := NewCLI("cb", "")
+			cli.AddCommand(NewCommand("bucket", "", "", func() {}))
+			cli.Version = &VersionInfo{Version: "7.1.0", GitCommit: "0123abcd"}
+			cli.VersionCommand = test.command
+			output := captureWriter(t, cli)
+
+			ctx := &Context{cli: cli, prevCmds: []string{}}
+			require.Equal(t, test.exitCode, cli.rootCommand(nil).parse(ctx, test.args))
+			if test.expected != "" {
+				require.Equal(t, test.expected, output())
+			}
+		})
+	}
+}
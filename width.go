@@ -0,0 +1,129 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// HelpWidthEnv is the environment variable which can be used to override the width the help output is wrapped to.
+const HelpWidthEnv = "CBFLAG_HELP_WIDTH"
+
+// MIN_USAGE_LEN is the narrowest the description column of the help output will be wrapped to.
+const MIN_USAGE_LEN int = 20
+
+var (
+	// Provide variable so that tests can provide a mock implementation.
+	terminalWidth = func(writer io.Writer) (int, bool) {
+		file, ok := writer.(*os.File)
+		if !ok {
+			return 0, false
+		}
+
+		width, _, err := term.GetSize(int(file.Fd()))
+		return width, err == nil && width > 0
+	}
+)
+
+// helpWidth returns the width the help output written to the writer should be wrapped to. This is the value of
+// HelpWidthEnv if set, otherwise the width of the terminal or TOTAL_LEN if the writer is not a terminal.
+func helpWidth(writer io.Writer) int {
+	width := TOTAL_LEN
+	if env, err := strconv.Atoi(os.Getenv(HelpWidthEnv)); err == nil && env > 0 {
+		width = env
+	} else if cols, ok := terminalWidth(writer); ok {
+		width = cols
+	}
+
+	if min := PREFIX_LEN + FLAGS_LEN + POSTFIX_LEN + MIN_USAGE_LEN; width < min {
+		return min
+	}
+
+	return width
+}
+
+// wrapText splits the text into lines which are at most width columns wide. Explicit newlines are kept, lines which
+// start with whitespace keep their indentation and have their continuation lines aligned with it. Words which are
+// wider than the width are not split.
+func wrapText(text string, width int) []string {
+	lines := make([]string, 0)
+	for _, paragraph := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeftFunc(paragraph, unicode.IsSpace)
+		indent := strings.Repeat(" ", displayWidth(strings.ReplaceAll(paragraph[:len(paragraph)-len(trimmed)], "\t",
+			"    ")))
+
+		words := strings.Fields(trimmed)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		line := indent + words[0]
+		lineWidth := displayWidth(line)
+		for _, word := range words[1:] {
+			wordWidth := displayWidth(word)
+			if lineWidth+1+wordWidth > width {
+				lines = append(lines, line)
+				line, lineWidth = indent+word, len(indent)+wordWidth
+				continue
+			}
+
+			line += " " + word
+			lineWidth += 1 + wordWidth
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// displayWidth returns the number of terminal columns used to display the string.
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+// runeWidth returns the number of terminal columns used to display the rune, combining and control characters take
+// no space and East Asian wide characters take two columns.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || unicode.IsControl(r) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0x303e,   // CJK Radicals ... CJK Symbols and Punctuation
+		r >= 0x3041 && r <= 0x33ff,   // Hiragana ... CJK Compatibility
+		r >= 0x3400 && r <= 0x4dbf,   // CJK Unified Ideographs Extension A
+		r >= 0x4e00 && r <= 0x9fff,   // CJK Unified Ideographs
+		r >= 0xa000 && r <= 0xa4cf,   // Yi Syllables and Radicals
+		r >= 0xac00 && r <= 0xd7a3,   // Hangul Syllables
+		r >= 0xf900 && r <= 0xfaff,   // CJK Compatibility Ideographs
+		r >= 0xfe30 && r <= 0xfe4f,   // CJK Compatibility Forms
+		r >= 0xff00 && r <= 0xff60,   // Fullwidth Forms
+		r >= 0xffe0 && r <= 0xffe6,   // Fullwidth Signs
+		r >= 0x1f300 && r <= 0x1f64f, // Miscellaneous Symbols and Pictographs, Emoticons
+		r >= 0x1f900 && r <= 0x1f9ff, // Supplemental Symbols and Pictographs
+		r >= 0x20000 && r <= 0x3fffd: // CJK Unified Ideographs Extension B onwards
+		return 2
+	}
+
+	return 1
+}
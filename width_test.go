@@ -0,0 +1,123 @@
+/*
+Copyright 2016-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package cbflag
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockTerminalWidth replaces the terminal width detection for the duration of a test, a width of zero means stdout is
+// not a terminal.
+func mockTerminalWidth(t *testing.T, width int) {
+	orig := terminalWidth
+	terminalWidth = func(io.Writer) (int, bool) { return width, width > 0 }
+	t.Cleanup(func() { terminalWidth = orig })
+}
+
+func TestHelpWidth(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		terminal int
+		expected int
+	}{
+		{name: "NotTerminal", expected: TOTAL_LEN},
+		{name: "Terminal", terminal: 120, expected: 120},
+		{name: "NarrowTerminal", terminal: 10, expected: PREFIX_LEN + FLAGS_LEN + POSTFIX_LEN + MIN_USAGE_LEN},
+		{name: "EnvOverride", env: "100", terminal: 120, expected: 100},
+		{name: "InvalidEnv", env: "wide", terminal: 120, expected: 120},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockTerminalWidth(t, test.terminal)
+			os.Setenv(HelpWidthEnv, test.env)
+			defer os.Unsetenv(HelpWidthEnv)
+
+			require.Equal(t, test.expected, helpWidth(os.Stdout))
+		})
+	}
+}
+
+func TestHelpWidthNotFile(t *testing.T) {
+	os.Setenv(HelpWidthEnv, "")
+	defer os.Unsetenv(HelpWidthEnv)
+
+	_, ok := terminalWidth(&bytes.Buffer{})
+	require.False(t, ok)
+	require.Equal(t, TOTAL_LEN, helpWidth(&bytes.Buffer{}))
+}
+
+func TestDisplayWidth(t *testing.T) {
+	require.Equal(t, 5, displayWidth("hello"))
+	require.Equal(t, 5, displayWidth("héllo"))
+	require.Equal(t, 5, displayWidth("héllo"))
+	require.Equal(t, 4, displayWidth("日本"))
+	require.Equal(t, 6, displayWidth("ｆｕｌ"))
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		width    int
+		expected []string
+	}{
+		{name: "Empty", text: "", width: 10, expected: []string{""}},
+		{name: "Fits", text: "one two", width: 10, expected: []string{"one two"}},
+		{name: "Wraps", text: "one two three four", width: 10, expected: []string{"one two", "three four"}},
+		{name: "LongWord", text: "a verylongwordindeed b", width: 10, expected: []string{"a", "verylongwordindeed", "b"}},
+		{name: "Newlines", text: "one\n\ntwo three", width: 7, expected: []string{"one", "", "two", "three"}},
+		{name: "Indented", text: "list:\n  * item one two", width: 12,
+			expected: []string{"list:", "  * item one", "  two"}},
+		{name: "Wide", text: "日本 日本 日本", width: 10, expected: []string{"日本 日本", "日本"}},
+		{name: "MultiByte", text: "ééé ééé ééé", width: 7, expected: []string{"ééé ééé", "ééé"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, wrapText(test.text, test.width))
+		})
+	}
+}
+
+func TestUsageWidth(t *testing.T) {
+	var value string
+
+	command := NewCommand("", "", "", func() {})
+	command.AddFlag(StringFlag(&value, "", "v", "value", "", "The value which is used by the command when it is "+
+		"run, which has quite a long description", []string{}, nil, false, false))
+	command.AddFlag(StringFlag(&value, "", "", "a-flag-with-a-very-long-name", "", "Short", []string{}, nil, false,
+		false))
+
+	mockTerminalWidth(t, 0)
+	require.Equal(t, "Optional Flags:\n\n"+
+		"  -v,--value                  The value which is used by the command when it is\n"+
+		"                              run, which has quite a long description\n"+
+		"     --a-flag-with-a-very-long-name\n"+
+		"                              Short\n\n", command.Usage())
+
+	os.Setenv(HelpWidthEnv, strconv.Itoa(60))
+	defer os.Unsetenv(HelpWidthEnv)
+
+	require.Equal(t, "Optional Flags:\n\n"+
+		"  -v,--value                  The value which is used by the\n"+
+		"                              command when it is run, which\n"+
+		"                              has quite a long description\n"+
+		"     --a-flag-with-a-very-long-name\n"+
+		"                              Short\n\n", command.Usage())
+}